@@ -0,0 +1,79 @@
+package app
+
+import (
+	"time"
+
+	. "payment/domain"
+)
+
+// Expiry is a part of application layer which releases authorizations that
+// were not captured before their expiry.
+//
+// Every authorization is added to Schedule, which survives restarts, so holds
+// are released even when service was down at their expiry.
+type Expiry struct {
+	transactions Transactions
+	schedule     Schedule
+	locks        Locks
+}
+
+func NewExpiry(t Transactions, s Schedule, l Locks) *Expiry {
+	return &Expiry{
+		transactions: t,
+		schedule:     s,
+		locks:        l,
+	}
+}
+
+// Release authorizations expired before given moment, failed ones stay in
+// Schedule and first failure is returned.
+func (e *Expiry) Release(at time.Time) (err error) {
+	l, err := e.schedule.Due(at)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range l {
+		if x := e.expire(id, at); x != nil {
+			if err == nil {
+				err = Err("#%s expiry failed due %w", id, x)
+			}
+
+			continue
+		}
+
+		if x := e.schedule.Remove(id); x != nil {
+			return x
+		}
+	}
+
+	return err
+}
+
+// expire under lock of Transaction, so capture in progress is not lost.
+func (e *Expiry) expire(id ID, at time.Time) error {
+	unlock, err := e.locks.Lock(id)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	a, err := e.transactions.Read(id)
+	if err != nil {
+		return err
+	}
+
+	if err = a.Expire(at); err != nil {
+		return err
+	}
+
+	return e.transactions.Write(a)
+}
+
+// Schedule keeps moments at which authorizations expire, it has to survive
+// restarts of service.
+type Schedule interface {
+	Add(ID, time.Time) error
+	Due(time.Time) ([]ID, error)
+	Remove(ID) error
+}
@@ -0,0 +1,22 @@
+package app
+
+// Idempotency keeps Results of requests made with idempotency key, so retried
+// request is answered with the original Result instead of being executed again.
+//
+// Keys expire after TTL of store.
+type Idempotency interface {
+	// Reserve key for request of given hash, Result stored under key is given
+	// when key was already reserved.
+	Reserve(key, hash string) (Result, bool, error)
+	Save(key string, r Result) error
+	// Release key of request which failed, so it can be retried.
+	Release(key string) error
+}
+
+// Result of request stored under idempotency key, Status is zero while request
+// is in progress.
+type Result struct {
+	Hash   string
+	Status int
+	Body   []byte
+}
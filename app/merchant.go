@@ -1,5 +1,17 @@
 package app
 
+import (
+	"time"
+
+	"payment/domain"
+)
+
 type Merchant interface {
+	ID() string
 	IsAuthenticated() bool
+	// Accepts tells if merchant takes cards of given Brand.
+	Accepts(domain.Brand) bool
+	// AuthorizationTTL tells how long authorization on card of given Brand is
+	// held, domain.Brand Hold is used when zero.
+	AuthorizationTTL(domain.Brand) time.Duration
 }
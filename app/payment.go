@@ -1,6 +1,11 @@
 package app
 
-import . "payment/domain"
+import (
+	"errors"
+	"time"
+
+	. "payment/domain"
+)
 
 // Payment is a part of application layer.
 //
@@ -12,71 +17,307 @@ type Payment struct {
 	id           ID
 	merchant     Merchant
 	transactions Transactions
+	rates        Rates
+	rounding     Rounding
+	cards        Cards
+	processor    Processor
+	schedule     Schedule
+	references   References
+	locks        Locks
 }
 
-func NewPayment(id ID, m Merchant, t Transactions) *Payment {
+func NewPayment(id ID, m Merchant, r Resources) *Payment {
 	return &Payment{
 		id:           id,
 		merchant:     m,
-		transactions: t,
+		transactions: r.Transactions,
+		rates:        r.Rates,
+		rounding:     r.Rounding,
+		cards:        r.Cards,
+		processor:    r.Processor,
+		schedule:     r.Schedule,
+		references:   r.References,
+		locks:        r.Locks,
+	}
+}
+
+// FindPayment by merchant reference of Order given on authorization.
+func FindPayment(reference string, m Merchant, r Resources) (*Payment, error) {
+	if !m.IsAuthenticated() {
+		return nil, ErrForbidden
+	}
+
+	id, err := r.References.Find(m.ID(), reference)
+	if err != nil {
+		return nil, err
 	}
+
+	return NewPayment(id, m, r), nil
 }
 
 func (t *Payment) ID() ID {
 	return t.id
 }
 
-func (t *Payment) Authorize(c CreditCard, m Money) (Money, error) {
+// Get current state of Transaction.
+func (t *Payment) Get() (Response, error) {
+	if !t.merchant.IsAuthenticated() {
+		return Response{}, ErrForbidden
+	}
+
+	a, err := t.transactions.Read(t.id)
+	if err != nil {
+		return Response{}, err
+	}
+
+	if a.IsZero() {
+		return Response{}, ErrTransactionNotFound
+	}
+
+	return newResponse(a), nil
+}
+
+// Authorize Money on CreditCard, settlement is currency in which card is charged,
+// when empty Money currency is used. Reference of Order has to be unique for
+// merchant.
+func (t *Payment) Authorize(c CreditCard, m Money, settlement string, o Order) (Response, error) {
+	return t.authorize(c, m, settlement, o, (*Transaction).Authorize)
+}
+
+// AuthorizeToken is Authorize with CreditCard stored in Cards vault.
+func (t *Payment) AuthorizeToken(k CardToken, m Money, settlement string, o Order) (Response, error) {
 	if !t.merchant.IsAuthenticated() {
-		return Money{}, ErrForbidden
+		return Response{}, ErrForbidden
 	}
 
-	return t.execute(func(a *Transaction) error { return a.Authorize(c, m) })
+	c, err := t.cards.Detokenize(k)
+	if err != nil {
+		return Response{}, err
+	}
+
+	return t.Authorize(c, m, settlement, o)
 }
 
-func (t *Payment) Void() (Money, error) {
+// Sale authorizes and captures Money on CreditCard in a single write.
+func (t *Payment) Sale(c CreditCard, m Money, settlement string, o Order) (Response, error) {
+	return t.authorize(c, m, settlement, o, (*Transaction).Sale)
+}
+
+// SaleToken is Sale with CreditCard stored in Cards vault.
+func (t *Payment) SaleToken(k CardToken, m Money, settlement string, o Order) (Response, error) {
 	if !t.merchant.IsAuthenticated() {
-		return Money{}, ErrForbidden
+		return Response{}, ErrForbidden
+	}
+
+	c, err := t.cards.Detokenize(k)
+	if err != nil {
+		return Response{}, err
+	}
+
+	return t.Sale(c, m, settlement, o)
+}
+
+// Verify CreditCard with zero amount in currency, ie before card is saved in
+// Wallet, Address is optional and checked by issuer when given.
+func (t *Payment) Verify(c CreditCard, currency string, d Address) (Response, error) {
+	if !t.merchant.IsAuthenticated() {
+		return Response{}, ErrForbidden
+	}
+
+	if c.IsZero() {
+		return Response{}, ErrInvalidCard
+	}
+
+	if !t.merchant.Accepts(c.Brand()) {
+		return Response{}, ErrBrandNotAccepted
+	}
+
+	m, err := NewMoney("0", currency)
+	if err != nil {
+		return Response{}, err
+	}
+
+	return t.execute(func(a *Transaction) error { return a.Verify(c, m, d, t.processor) })
+}
+
+func (t *Payment) authorize(c CreditCard, m Money, settlement string, o Order, f authorization) (Response, error) {
+	if !t.merchant.IsAuthenticated() {
+		return Response{}, ErrForbidden
+	}
+
+	// card is validated first, hold of its brand tells expiry
+	if c.IsZero() {
+		return Response{}, ErrInvalidCard
+	}
+
+	if !t.merchant.Accepts(c.Brand()) {
+		return Response{}, ErrBrandNotAccepted
+	}
+
+	x, err := t.exchange(m, settlement)
+	if err != nil {
+		return Response{}, err
+	}
+
+	h := t.merchant.AuthorizationTTL(c.Brand())
+	if h == 0 {
+		h = c.Brand().Hold()
+	}
+
+	if o.Reference != "" {
+		if err = t.references.Reserve(t.merchant.ID(), o.Reference, t.id); err != nil {
+			return Response{}, err
+		}
+	}
+
+	// scheduled before authorization, so hold is never missed by Expiry
+	e := time.Now().Add(h)
+	if err = t.schedule.Add(t.id, e); err != nil {
+		if o.Reference != "" {
+			if x := t.references.Release(t.merchant.ID(), o.Reference); x != nil {
+				return Response{}, x
+			}
+		}
+
+		return Response{}, err
+	}
+
+	// reference of failed authorization can be used again, unless authorization
+	// was written, ie by Sale which failed to capture, so it is still found
+	r, err := t.execute(func(a *Transaction) error { return f(a, c, x, e, o, t.processor) })
+	if err != nil && o.Reference != "" && (r.Transaction == "" || r.Status == Declined) {
+		if x := t.references.Release(t.merchant.ID(), o.Reference); x != nil {
+			return Response{}, x
+		}
+	}
+
+	return r, err
+}
+
+func (t *Payment) IncrementAuthorization(m Money) (Response, error) {
+	if !t.merchant.IsAuthenticated() {
+		return Response{}, ErrForbidden
+	}
+
+	return t.execute(func(a *Transaction) error { return a.IncrementAuthorization(m, t.rounding, t.processor) })
+}
+
+func (t *Payment) Void() (Response, error) {
+	if !t.merchant.IsAuthenticated() {
+		return Response{}, ErrForbidden
 	}
 
 	return t.execute(func(a *Transaction) error { return a.Void() })
 }
 
-func (t *Payment) Capture(m Money) (Money, error) {
+// Capture Money of authorization, final capture releases remaining balance.
+func (t *Payment) Capture(m Money, final bool) (Response, error) {
 	if !t.merchant.IsAuthenticated() {
-		return Money{}, ErrForbidden
+		return Response{}, ErrForbidden
 	}
 
-	return t.execute(func(a *Transaction) error { return a.Capture(m) })
+	return t.execute(func(a *Transaction) error { return a.Capture(m, final, t.rounding, t.processor) })
 }
 
-func (t *Payment) Refund(m Money) (Money, error) {
+// Reverse releases part of uncaptured authorization.
+func (t *Payment) Reverse(m Money) (Response, error) {
 	if !t.merchant.IsAuthenticated() {
-		return Money{}, ErrForbidden
+		return Response{}, ErrForbidden
+	}
+
+	return t.execute(func(a *Transaction) error { return a.Reverse(m, t.rounding, t.processor) })
+}
+
+// Refund Money of capture, which can be empty when there is only one.
+func (t *Payment) Refund(capture ID, m Money) (Response, error) {
+	if !t.merchant.IsAuthenticated() {
+		return Response{}, ErrForbidden
+	}
+
+	return t.execute(func(a *Transaction) error { return a.Refund(capture, m, t.rounding, t.processor) })
+}
+
+// execute command on fresh Transaction until it is written without conflict,
+// at most retries times. Commands of Transaction are executed under its lock,
+// so Processor is never called by command which loses race with another one,
+// conflict is left only with writers bypassing Locks.
+func (t *Payment) execute(c command) (r Response, err error) {
+	unlock, err := t.locks.Lock(t.id)
+	if err != nil {
+		return Response{}, err
 	}
+	defer unlock()
 
-	return t.execute(func(a *Transaction) error { return a.Refund(m) })
+	for i := 0; i < retries; i++ {
+		if r, err = t.try(c); !errors.As(err, new(VersionConflictError)) {
+			return r, err
+		}
+	}
+
+	return r, err
 }
 
-func (t *Payment) execute(c command) (available Money, err error) {
+func (t *Payment) try(c command) (Response, error) {
 	a, err := t.transactions.Read(t.id)
 	if err != nil {
-		return
+		return Response{}, err
 	}
 
 	if err = c(a); err != nil {
-		return
+		if len(a.Uncommitted(false)) == 0 {
+			return Response{}, err
+		}
+
+		// declines are recorded as events, so they have to be written too and
+		// Response tells which Transaction recorded it
+		if x := t.transactions.Write(a); x != nil {
+			return Response{}, x
+		}
+
+		return newResponse(a), err
 	}
 
 	if err = t.transactions.Write(a); err != nil {
-		return
+		return Response{}, err
+	}
+
+	return newResponse(a), nil
+}
+
+func (t *Payment) exchange(m Money, to string) (Exchange, error) {
+	if to == "" {
+		to = m.Currency()
+	}
+
+	to, err := NewCurrency(to)
+	if err != nil {
+		return Exchange{}, err
+	}
+
+	r, err := t.rates.Rate(m.Currency(), to, time.Now())
+	if err != nil {
+		return Exchange{}, err
 	}
 
-	return a.Balance(), nil
+	return NewExchange(m, r, t.rounding)
 }
 
 type Payments interface {
 	Read(ID, Merchant) *Payment
+	Find(reference string, m Merchant) (*Payment, error)
+	Wallet(Merchant) *Wallet
+}
+
+// Resources are infrastructure services used by application layer.
+type Resources struct {
+	Transactions Transactions
+	Rates        Rates
+	Rounding     Rounding
+	Cards        Cards
+	Processor    Processor
+	Schedule     Schedule
+	References   References
+	Locks        Locks
 }
 
 type Transactions interface {
@@ -84,12 +325,64 @@ type Transactions interface {
 	Write(*Transaction) error
 }
 
+// References map merchant references of Orders to Transactions, reference is
+// unique for merchant.
+type References interface {
+	Reserve(merchant, reference string, id ID) error
+	Release(merchant, reference string) error
+	Find(merchant, reference string) (ID, error)
+}
+
+// Locks serialize commands of Transaction, they have to be shared by all
+// processes writing the same Transactions.
+type Locks interface {
+	// Lock Transaction of ID until returned unlock is called.
+	Lock(ID) (unlock func(), err error)
+}
+
 type command func(*Transaction) error
 
-var ErrForbidden = Err("access forbidden")
+const retries = 3
+
+// authorization is Transaction command which holds Money on CreditCard.
+type authorization func(*Transaction, CreditCard, Exchange, time.Time, Order, Processor) error
 
+var (
+	ErrForbidden           = NewError(Forbidden, "forbidden", "access forbidden")
+	ErrInvalidCard         = NewError(Validation, "invalid_card", "invalid card data")
+	ErrBrandNotAccepted    = NewError(Validation, "card_brand_not_accepted", "card brand not accepted by merchant")
+	ErrTransactionNotFound = NewError(NotFound, "transaction_not_found", "transaction not found")
+)
+
+// Response is state of Transaction after command.
 type Response struct {
 	Transaction ID
+	Status      Status
+	Card        Card
+	Order       Order
 	Available   Money
-	Error       error
+	Captured    Money
+	Refunded    Money
+	Released    Money
+	Captures    []Capture
+	Refunds     []Refund
+
+	Verification Verification
+}
+
+func newResponse(a *Transaction) Response {
+	return Response{
+		Transaction: ID(a.ID()),
+		Status:      a.Status(),
+		Card:        a.Card(),
+		Order:       a.Order(),
+		Available:   a.Balance(),
+		Captured:    a.Captured(),
+		Refunded:    a.Refunded(),
+		Released:    a.Released(),
+		Captures:    a.Captures(),
+		Refunds:     a.Refunds(),
+
+		Verification: a.Verification(),
+	}
 }
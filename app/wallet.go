@@ -0,0 +1,50 @@
+package app
+
+import . "payment/domain"
+
+// Wallet is a part of application layer which lets merchant store CreditCards
+// of customers and use CardTokens instead of raw card data.
+type Wallet struct {
+	merchant Merchant
+	cards    Cards
+}
+
+func NewWallet(m Merchant, c Cards) *Wallet {
+	return &Wallet{
+		merchant: m,
+		cards:    c,
+	}
+}
+
+func (w *Wallet) Tokenize(c CreditCard) (CardToken, Card, error) {
+	if !w.merchant.IsAuthenticated() {
+		return "", Card{}, ErrForbidden
+	}
+
+	if !w.merchant.Accepts(c.Brand()) {
+		return "", Card{}, ErrBrandNotAccepted
+	}
+
+	t, err := w.cards.Tokenize(c)
+	if err != nil {
+		return "", Card{}, err
+	}
+
+	return t, c.Card(), nil
+}
+
+func (w *Wallet) Delete(t CardToken) error {
+	if !w.merchant.IsAuthenticated() {
+		return ErrForbidden
+	}
+
+	return w.cards.Delete(t)
+}
+
+// Cards is a vault of tokenized CreditCards, Detokenize is for internal use
+// only and its result can not be exposed outside of application.
+type Cards interface {
+	Tokenize(CreditCard) (CardToken, error)
+	Detokenize(CardToken) (CreditCard, error)
+	Delete(CardToken) error
+}
@@ -0,0 +1,142 @@
+package domain
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Brand is card network recognized from IIN (BIN) range of card number.
+type Brand string
+
+const (
+	Visa       Brand = "visa"
+	Mastercard Brand = "mastercard"
+	Amex       Brand = "amex"
+	Discover   Brand = "discover"
+	JCB        Brand = "jcb"
+	UnionPay   Brand = "unionpay"
+	Maestro    Brand = "maestro"
+	Diners     Brand = "diners"
+)
+
+func NewBrand(name string) (Brand, error) {
+	b := Brand(strings.ToLower(strings.TrimSpace(name)))
+	for _, s := range brands {
+		if s.brand == b {
+			return b, nil
+		}
+	}
+
+	return "", errCreditCardBrand
+}
+
+func (b Brand) String() string {
+	return string(b)
+}
+
+// Hold tells how long card network keeps authorization of Brand by default.
+func (b Brand) Hold() time.Duration {
+	s, _ := b.spec()
+	return s.hold
+}
+
+func (b Brand) spec() (brandSpec, bool) {
+	for _, s := range brands {
+		if s.brand == b {
+			return s, true
+		}
+	}
+
+	return brandSpec{}, false
+}
+
+// Brands is a set of card networks, ie accepted by merchant.
+type Brands []Brand
+
+func NewBrands(names ...string) (Brands, error) {
+	var l Brands
+	for _, n := range names {
+		b, err := NewBrand(n)
+		if err != nil {
+			return nil, err
+		}
+
+		l = append(l, b)
+	}
+
+	return l, nil
+}
+
+func (l Brands) Has(b Brand) bool {
+	for i := range l {
+		if l[i] == b {
+			return true
+		}
+	}
+
+	return false
+}
+
+// detectBrand finds Brand of card number by its IIN prefix.
+func detectBrand(n string) (brandSpec, bool) {
+	for _, s := range brands {
+		for _, r := range s.iin {
+			if r.has(n) {
+				return s, true
+			}
+		}
+	}
+
+	return brandSpec{}, false
+}
+
+type brandSpec struct {
+	brand   Brand
+	iin     []iin
+	lengths []int
+	cvv     int
+	hold    time.Duration
+}
+
+func (s brandSpec) hasLength(n string) bool {
+	for _, l := range s.lengths {
+		if len(n) == l {
+			return true
+		}
+	}
+
+	return false
+}
+
+// iin is range of card number prefixes, both ends have the same number of digits.
+type iin struct {
+	from, to string
+}
+
+func (r iin) has(n string) bool {
+	if len(n) < len(r.from) {
+		return false
+	}
+
+	p, _ := strconv.Atoi(n[:len(r.from)])
+	f, _ := strconv.Atoi(r.from)
+	t, _ := strconv.Atoi(r.to)
+
+	return p >= f && p <= t
+}
+
+// brands are checked in order, ranges nested in ranges of another Brand
+// (ie Discover in UnionPay) have to be listed first.
+var brands = []brandSpec{
+	{Amex, []iin{{"34", "34"}, {"37", "37"}}, []int{15}, 4, 7 * day},
+	{Diners, []iin{{"300", "305"}, {"3095", "3095"}, {"36", "36"}, {"38", "39"}}, []int{14, 15, 16, 17, 18, 19}, 3, 10 * day},
+	{JCB, []iin{{"3528", "3589"}}, []int{16, 17, 18, 19}, 3, 7 * day},
+	{Visa, []iin{{"4", "4"}}, []int{13, 16, 19}, 3, 7 * day},
+	{Maestro, []iin{{"5018", "5018"}, {"5020", "5020"}, {"5038", "5038"}, {"5893", "5893"}, {"6304", "6304"}, {"6759", "6759"}, {"6761", "6763"}}, []int{12, 13, 14, 15, 16, 17, 18, 19}, 3, 7 * day},
+	{Mastercard, []iin{{"51", "55"}, {"2221", "2720"}}, []int{16}, 3, 7 * day},
+	{Discover, []iin{{"6011", "6011"}, {"622126", "622925"}, {"644", "649"}, {"65", "65"}}, []int{16, 17, 18, 19}, 3, 10 * day},
+	{UnionPay, []iin{{"62", "62"}, {"81", "81"}}, []int{16, 17, 18, 19}, 3, 30 * day},
+}
+
+const day = 24 * time.Hour
@@ -0,0 +1,37 @@
+package domain
+
+import "fmt"
+
+// Capture is movement of authorized Money to merchant, it can be refunded in
+// part or in whole by Refunds referencing its ID. Refunds are converted into
+// Settlement currency at Rate of Capture.
+type Capture struct {
+	ID         ID
+	Sequence   int
+	Amount     Money
+	Settlement Money
+	Rate       Rate
+	Refunded   Money
+	Final      bool
+}
+
+// Refundable part of Capture.
+func (c Capture) Refundable() (Money, error) {
+	return c.Amount.sub(c.Refunded)
+}
+
+// Refund returns part of Capture to card.
+type Refund struct {
+	ID         ID
+	Capture    ID
+	Amount     Money
+	Settlement Money
+}
+
+func newCaptureID(t ID, sequence int) ID {
+	return ID(fmt.Sprintf("%s.c%d", t, sequence))
+}
+
+func newRefundID(t ID, sequence int) ID {
+	return ID(fmt.Sprintf("%s.r%d", t, sequence))
+}
@@ -0,0 +1,118 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Card is PCI safe part of CreditCard which is persisted in events.
+//
+// It holds masked number (first 6 and last 4 digits), brand, expiry and
+// fingerprint, which is the same for every CreditCard with the same number.
+// Full number and cvv never reach Card.
+type Card struct {
+	masked      string
+	brand       Brand
+	expiry      expiry
+	fingerprint string
+}
+
+// Masked number of Card, ie 400000******0119.
+func (c Card) Masked() string {
+	return c.masked
+}
+
+func (c Card) Brand() Brand {
+	return c.brand
+}
+
+func (c Card) Fingerprint() string {
+	return c.fingerprint
+}
+
+func (c Card) IsExpired(d ...time.Time) bool {
+	t := time.Now()
+	if len(d) != 0 {
+		t = d[0]
+	}
+
+	return c.expiry.date.Before(t)
+}
+
+func (c Card) IsZero() bool {
+	return c.fingerprint == ""
+}
+
+func (c Card) String() string {
+	return fmt.Sprintf(`%s %s %s`, c.brand, c.masked, c.expiry)
+}
+
+func (c Card) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonCard{
+		Number:      c.masked,
+		Brand:       c.brand.String(),
+		Expire:      c.expiry.String(),
+		Fingerprint: c.fingerprint,
+	})
+}
+
+func (c *Card) UnmarshalJSON(b []byte) error {
+	if bytes.Equal(b, null) {
+		return nil
+	}
+
+	var j jsonCard
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+
+	if len(j.Number) < 12 || j.Fingerprint == "" {
+		return errCreditCard
+	}
+
+	e, err := newExpiry(j.Expire)
+	if err != nil {
+		return err
+	}
+
+	r, err := NewBrand(j.Brand)
+	if err != nil {
+		return err
+	}
+
+	*c = Card{masked: j.Number, brand: r, expiry: e, fingerprint: j.Fingerprint}
+	return nil
+}
+
+// GobEncode Card as JSON, so it can be part of binary encoded events.
+func (c Card) GobEncode() ([]byte, error) {
+	return c.MarshalJSON()
+}
+
+func (c *Card) GobDecode(b []byte) error {
+	return c.UnmarshalJSON(b)
+}
+
+// CardToken is opaque reference to CreditCard stored in tokens vault.
+type CardToken string
+
+func NewCardToken(s string) (CardToken, error) {
+	if len(s) < 8 || !strings.HasPrefix(s, "tok_") {
+		return "", errCardToken
+	}
+
+	return CardToken(s), nil
+}
+
+func (t CardToken) String() string {
+	return string(t)
+}
+
+type jsonCard struct {
+	Number, Brand, Expire, Fingerprint string
+}
+
+var errCardToken = NewError(Validation, "invalid_card_token", "card token: invalid, expected tok_ prefix")
@@ -2,6 +2,10 @@ package domain
 
 import (
 	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"strconv"
@@ -9,14 +13,33 @@ import (
 	"time"
 )
 
+// CreditCard is sensitive card data given by customer, it is used only for
+// command processing and never persisted. Card is its persisted part.
 type CreditCard struct {
 	owner
 	number
 	expiry
 	cvv
+	brand Brand
 }
 
 func NewCreditCard(owner, number, expiry, cvv string) (CreditCard, error) {
+	c, err := NewCardOnFile(owner, number, expiry)
+	if err != nil {
+		return CreditCard{}, err
+	}
+
+	b, _ := c.brand.spec()
+	if c.cvv, err = newCVV(cvv, b.cvv); err != nil {
+		return CreditCard{}, err
+	}
+
+	return c, nil
+}
+
+// NewCardOnFile gives CreditCard stored earlier for customer, ie in tokens
+// vault. Such CreditCard is used without cvv.
+func NewCardOnFile(owner, number, expiry string) (CreditCard, error) {
 	var c CreditCard
 	var err error
 
@@ -28,14 +51,20 @@ func NewCreditCard(owner, number, expiry, cvv string) (CreditCard, error) {
 		return CreditCard{}, err
 	}
 
-	if c.expiry, err = newExpiry(expiry); err != nil {
-		return CreditCard{}, err
+	b, ok := detectBrand(string(c.number))
+	if !ok {
+		return CreditCard{}, errCreditCardBrand
 	}
 
-	if c.cvv, err = newCVV(cvv); err != nil {
+	if !b.hasLength(string(c.number)) {
+		return CreditCard{}, errCreditCardNumber
+	}
+
+	if c.expiry, err = newExpiry(expiry); err != nil {
 		return CreditCard{}, err
 	}
 
+	c.brand = b.brand
 	return c, nil
 }
 
@@ -48,30 +77,54 @@ func (c CreditCard) IsExpired(d ...time.Time) bool {
 	return c.expiry.date.Before(t)
 }
 
-func (c CreditCard) Number() int {
-	return int(c.number)
+func (c CreditCard) Owner() string {
+	return string(c.owner)
+}
+
+func (c CreditCard) Number() string {
+	return string(c.number)
+}
+
+// Expiry in mm/yyyy format.
+func (c CreditCard) Expiry() string {
+	return c.expiry.String()
+}
+
+// HasCVV tells if cvv was given, CreditCard created by NewCardOnFile has none.
+func (c CreditCard) HasCVV() bool {
+	return c.cvv != ""
+}
+
+// Card gives PCI safe part of CreditCard which can be stored.
+func (c CreditCard) Card() Card {
+	if c.IsZero() {
+		return Card{}
+	}
+
+	return Card{
+		masked:      c.number.masked(),
+		brand:       c.brand,
+		expiry:      c.expiry,
+		fingerprint: c.number.fingerprint(),
+	}
+}
+
+func (c CreditCard) Brand() Brand {
+	return c.brand
 }
 
 func (c CreditCard) IsZero() bool {
-	return c.number == 0
+	return c.number == ""
 }
 
+// String never reveals number nor cvv of CreditCard.
 func (c CreditCard) String() string {
-	return fmt.Sprintf(`%s %d %s %d`,
-		c.owner,
-		c.number,
-		c.expiry,
-		c.cvv,
-	)
+	return fmt.Sprintf(`%s %s`, c.owner, c.Card())
 }
 
+// MarshalJSON gives Card representation, number and cvv are never written.
 func (c CreditCard) MarshalJSON() ([]byte, error) {
-	return json.Marshal(jsonCreditCard{
-		Owner:  string(c.owner),
-		Number: c.number.String(),
-		Expire: c.expiry.String(),
-		CVV:    c.cvv.String(),
-	})
+	return c.Card().MarshalJSON()
 }
 
 func (c *CreditCard) UnmarshalJSON(b []byte) error {
@@ -103,18 +156,19 @@ func newOwner(name string) (owner, error) {
 	return owner(name), nil
 }
 
-type number int
+// number is PAN of card, kept as digits since it exceeds int64 range and its
+// leading digits are meaningful.
+type number string
 
 func newNumber(num string) (number, error) {
-	n, err := strconv.Atoi(strings.ReplaceAll(num, " ", ""))
-	if err != nil {
-		return 0, errCreditCardNumber
+	n := strings.ReplaceAll(num, " ", "")
+	if len(n) < 12 || len(n) > 19 || !isDigits(n) {
+		return "", errCreditCardNumber
 	}
 
-	var m = n / 10
 	var s = 0
-	for i := 0; m > 0; i++ {
-		cur := m % 10
+	for i := 0; i < len(n)-1; i++ {
+		cur := int(n[len(n)-2-i] - '0')
 		if i%2 == 0 { // even
 			cur = cur * 2
 			if cur > 9 {
@@ -123,35 +177,61 @@ func newNumber(num string) (number, error) {
 		}
 
 		s += cur
-		m = m / 10
 	}
 
-	if (n%10+s%10)%10 != 0 {
-		return 0, errCreditCardNumber
+	if (int(n[len(n)-1]-'0')+s%10)%10 != 0 {
+		return "", errCreditCardNumber
 	}
 
 	return number(n), nil
 }
 
-func newNumberMust(num string) number {
+// masked number keeps only first 6 and last 4 digits, ie 400000******0119.
+func (n number) masked() string {
+	return string(n[:6]) + strings.Repeat("*", len(n)-10) + string(n[len(n)-4:])
+}
+
+// Fingerprint of card number, the same which Card of such number has.
+func Fingerprint(num string) (string, error) {
 	n, err := newNumber(num)
 	if err != nil {
-		panic(err)
+		return "", err
 	}
-	return n
+
+	return n.fingerprint(), nil
 }
 
-func (n number) String() string {
-	return strconv.Itoa(int(n))
+// fingerprint is HMAC of number keyed with secret, which is never stored with
+// Cards, so number can not be recovered from masked number and fingerprint by
+// trying all numbers of its digits.
+func (n number) fingerprint() string {
+	h := hmac.New(sha256.New, fingerprintKey)
+	h.Write([]byte(n))
+	return hex.EncodeToString(h.Sum(nil))
 }
 
-var (
-	cardFailures = struct{ auth, capture, refund number }{
-		auth:    newNumberMust("4000 0000 0000 0119"),
-		capture: newNumberMust("4000 0000 0000 0259"),
-		refund:  newNumberMust("4000 0000 0000 3238"),
+// SetFingerprintKey of Card fingerprints, it has to be secret and the same in
+// every instance of service in order to keep fingerprints stable. Random key is
+// used until it is set, so fingerprints differ after restart.
+func SetFingerprintKey(k []byte) error {
+	if len(k) < fingerprintKeyLength {
+		return errFingerprintKey
 	}
-)
+
+	fingerprintKey = append([]byte(nil), k...)
+	return nil
+}
+
+const fingerprintKeyLength = 32
+
+var fingerprintKey = func() []byte {
+	k := make([]byte, fingerprintKeyLength)
+	if _, err := rand.Read(k); err != nil {
+		panic(err)
+	}
+
+	return k
+}()
 
 type expiry struct {
 	date time.Time
@@ -185,23 +265,19 @@ func (e expiry) String() string {
 	return fmt.Sprintf("%02d/%d", e.date.Month(), e.date.Year())
 }
 
-type cvv int
+// cvv is card security code, 3 digits long or 4 for Amex (CID).
+type cvv string
 
-func newCVV(code string) (cvv, error) {
-	if len(code) != 3 {
-		return 0, errCreditCardSecurityCode
-	}
-
-	c, err := strconv.Atoi(code)
-	if err != nil {
-		return 0, errCreditCardSecurityCode
+func newCVV(code string, length int) (cvv, error) {
+	if len(code) != length || !isDigits(code) {
+		return "", errCreditCardSecurityCode
 	}
 
-	return cvv(c), nil
+	return cvv(code), nil
 }
 
 func (c cvv) String() string {
-	return strconv.Itoa(int(c))
+	return string(c)
 }
 
 type jsonCreditCard struct {
@@ -209,13 +285,12 @@ type jsonCreditCard struct {
 }
 
 var (
-	errCreditCard             = Err("credit card: invalid card data")
-	errCreditCardSecurityCode = Err("credit card: invalid cvv code, expected at least 3 digits")
-	errCreditCardOwner        = Err("credit card: invalid owner name, expected at least 3 characters")
-	errCreditCardNumber       = Err("credit card: invalid number")
-	errCreditCardExpire       = Err("credit card: invalid expire date, expected `mm/yyyy` format ")
-	errCreditCardExpired      = Err("credit card: expired")
-	errCreditCardAuth         = Err("credit card: authorization failure")
-	errCreditCardCapture      = Err("credit card: capture failure")
-	errCreditCardRefund       = Err("credit card: refund failure")
+	errCreditCard             = NewError(Validation, "invalid_card", "credit card: invalid card data")
+	errCreditCardSecurityCode = NewError(Validation, "invalid_cvv", "credit card: invalid cvv code, expected 3 digits or 4 for amex")
+	errCreditCardOwner        = NewError(Validation, "invalid_card_owner", "credit card: invalid owner name, expected at least 3 characters")
+	errCreditCardNumber       = NewError(Validation, "invalid_card_number", "credit card: invalid number")
+	errCreditCardBrand        = NewError(Validation, "unsupported_card_brand", "credit card: unsupported brand")
+	errCreditCardExpire       = NewError(Validation, "invalid_card_expiry", "credit card: invalid expire date, expected `mm/yyyy` format ")
+	errCreditCardExpired      = newDecline(HardDecline, "54", "expired_card", "expired card")
+	errFingerprintKey         = Err("credit card: fingerprint key has to be at least 32 bytes long")
 )
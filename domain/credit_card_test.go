@@ -1,25 +1,22 @@
 package domain
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"testing"
 )
 
 func TestNewCreditCard(t *testing.T) {
-	c, err := NewCreditCard("Tom", "4000000000000044", "04/2022", "884")
-
-	fmt.Println(c, err)
-	fmt.Println(c.IsExpired())
-
-	b, _ := json.MarshalIndent(c, "", "\t")
-	fmt.Println(string(b))
-
 	type (
 		have struct {
+			number, cvv string
 		}
 
 		want struct {
+			brand Brand
+			err   error
 		}
 
 		case_ struct {
@@ -30,18 +27,92 @@ func TestNewCreditCard(t *testing.T) {
 	)
 
 	scenario := []case_{
-		{"my first subtest", have{}, want{}},
-	}
-
-	check := func(in have) (out want) {
-		return
+		{"visa 16 digits", have{"4111 1111 1111 1111", "123"}, want{Visa, nil}},
+		{"visa 13 digits", have{"4222222222222", "123"}, want{Visa, nil}},
+		{"visa 12 digits gives error", have{"411111111117", "123"}, want{"", errCreditCardNumber}},
+		{"visa with 4 digits cvv gives error", have{"4111111111111111", "1234"}, want{"", errCreditCardSecurityCode}},
+		{"mastercard", have{"5555555555554444", "123"}, want{Mastercard, nil}},
+		{"mastercard 2 series", have{"2223003122003222", "123"}, want{Mastercard, nil}},
+		{"amex with 4 digits cid", have{"378282246310005", "1234"}, want{Amex, nil}},
+		{"amex with 3 digits cvv gives error", have{"378282246310005", "123"}, want{"", errCreditCardSecurityCode}},
+		{"amex 14 digits gives error", have{"37828224631003", "1234"}, want{"", errCreditCardNumber}},
+		{"discover", have{"6011111111111117", "123"}, want{Discover, nil}},
+		{"discover in unionpay range", have{"6221260000000000", "123"}, want{Discover, nil}},
+		{"jcb", have{"3530111333300000", "123"}, want{JCB, nil}},
+		{"unionpay", have{"6200000000000005", "123"}, want{UnionPay, nil}},
+		{"maestro", have{"6759649826438453", "123"}, want{Maestro, nil}},
+		{"diners 16 digits", have{"3056930009020004", "123"}, want{Diners, nil}},
+		{"diners 14 digits", have{"36227206271667", "123"}, want{Diners, nil}},
+		{"luhn valid garbage gives error", have{"000000000000", "123"}, want{"", errCreditCardBrand}},
+		{"luhn invalid gives error", have{"4111111111111112", "123"}, want{"", errCreditCardNumber}},
+		{"cvv with letters gives error", have{"4111111111111111", "12a"}, want{"", errCreditCardSecurityCode}},
 	}
 
 	for _, c := range scenario {
 		t.Run(c.description, func(t *testing.T) {
-			if out := check(c.have); out != c.want {
+			n, err := NewCreditCard("Tom", c.have.number, "04/2099", c.have.cvv)
+			if out := (want{n.Brand(), err}); out != c.want {
 				t.Fatalf("expected:%v got:%v", c.want, out)
 			}
 		})
 	}
 }
+
+func TestCreditCard_Card(t *testing.T) {
+	c, err := NewCreditCard("Tom", "4000 0000 0000 0119", "04/2099", "884")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := TransactionAuthorized{Card: c.Card()}
+	for _, v := range []interface{}{c, e} {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, s := range []string{string(b), fmt.Sprint(v)} {
+			if strings.Contains(s, c.Number()) || strings.Contains(s, "884") {
+				t.Fatalf("expected no number nor cvv got:%s", s)
+			}
+		}
+	}
+
+	var n Card
+	if b, _ := json.Marshal(c); json.Unmarshal(b, &n) != nil || n != c.Card() {
+		t.Fatalf("expected:%v got:%v", c.Card(), n)
+	}
+
+	if n.Masked() != "400000******0119" || n.Brand() != Visa {
+		t.Fatalf("expected:400000******0119 visa got:%s %s", n.Masked(), n.Brand())
+	}
+
+	d, _ := NewCreditCard("Ann", "4000000000000119", "01/2098", "123")
+	if d.Card().Fingerprint() != n.Fingerprint() {
+		t.Fatalf("expected same fingerprint for same number")
+	}
+}
+
+func TestSetFingerprintKey(t *testing.T) {
+	defer func(k []byte) { fingerprintKey = k }(fingerprintKey)
+
+	c, err := NewCreditCard("Tom", "4000 0000 0000 0119", "04/2099", "884")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := c.Card().Fingerprint()
+	for _, x := range []struct {
+		case_ string
+		have  []byte
+		want  bool
+	}{
+		{"short", []byte("payment"), false},
+		{"secret", bytes.Repeat([]byte{7}, 32), true},
+	} {
+		err := SetFingerprintKey(x.have)
+		if have := c.Card().Fingerprint() != f; (err == nil) != x.want || have != x.want {
+			t.Fatalf("%s expected:%v got:%v %v", x.case_, x.want, have, err)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package domain
+
+import "fmt"
+
+// Error is failure with stable machine Code, which callers can branch on
+// instead of matching Message. Declines of card network carry issuer
+// Response code (ISO 8583 field 39), ie 05 do not honor or 51 insufficient funds.
+type Error struct {
+	Code     string
+	Class    Class
+	Response string `json:",omitempty"`
+	Message  string
+}
+
+func NewError(c Class, code, message string, a ...interface{}) *Error {
+	return &Error{Code: code, Class: c, Message: fmt.Sprintf(message, a...)}
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// VersionConflictError is returned when aggregate is written with Expected
+// version of stream, which was changed to Actual one in the meantime.
+type VersionConflictError struct {
+	Stream           string
+	Expected, Actual int
+}
+
+func (e VersionConflictError) Error() string {
+	return fmt.Sprintf("%s #%s, expected version %d, got %d", errVersionConflict, e.Stream, e.Expected, e.Actual)
+}
+
+func (e VersionConflictError) Unwrap() error {
+	return errVersionConflict
+}
+
+// Class of Error tells how caller should handle failure.
+type Class string
+
+const (
+	// HardDecline will not succeed on retry.
+	HardDecline Class = "hard_decline"
+	// SoftDecline may succeed on retry, ie when issuer was unavailable.
+	SoftDecline Class = "soft_decline"
+	// Validation of given data failed.
+	Validation Class = "validation"
+	// Conflict with current state of resource.
+	Conflict Class = "state_conflict"
+	NotFound Class = "not_found"
+	// Forbidden for caller.
+	Forbidden Class = "forbidden"
+	// Unprocessable request, ie idempotency key reused for another request.
+	Unprocessable Class = "unprocessable"
+)
+
+var errVersionConflict = NewError(Conflict, "version_conflict", "event store: stream changed concurrently")
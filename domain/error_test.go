@@ -0,0 +1,47 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestError(t *testing.T) {
+	type (
+		have error
+
+		want struct {
+			code     string
+			class    Class
+			response string
+		}
+
+		case_ struct {
+			description string
+			have
+			want
+		}
+	)
+
+	scenario := []case_{
+		{"not found", errTxNotFound, want{"transaction_not_found", NotFound, ""}},
+		{"currency mismatch", CurrencyMismatchError{"USD", "EUR"}, want{"currency_mismatch", Validation, ""}},
+		{"expired card", errCreditCardExpired, want{"expired_card", HardDecline, "54"}},
+		{"do not honor", NewDecline("05"), want{"do_not_honor", HardDecline, "05"}},
+		{"insufficient funds", NewDecline("51"), want{"insufficient_funds", SoftDecline, "51"}},
+		{"unknown response code", NewDecline("X1"), want{"card_declined", HardDecline, "X1"}},
+		{"wrapped", Err("checkout: %w", errTxVoided), want{"transaction_voided", Conflict, ""}},
+	}
+
+	for _, c := range scenario {
+		t.Run(c.description, func(t *testing.T) {
+			var e *Error
+			if !errors.As(c.have, &e) {
+				t.Fatalf("expected:%v got:%v", c.want, c.have)
+			}
+
+			if out := (want{e.Code, e.Class, e.Response}); out != c.want {
+				t.Fatalf("expected:%v got:%v", c.want, out)
+			}
+		})
+	}
+}
@@ -0,0 +1,273 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// Rate tells how many units of `to` currency one unit of `from` currency is
+// worth at given moment.
+type Rate struct {
+	from, to currency
+	value    string
+	at       time.Time
+}
+
+func NewRate(from, to, value string, at time.Time) (Rate, error) {
+	var r Rate
+	var err error
+
+	if r.from, err = newCurrency(from); err != nil {
+		return Rate{}, err
+	}
+
+	if r.to, err = newCurrency(to); err != nil {
+		return Rate{}, err
+	}
+
+	value = strings.TrimSpace(value)
+	if !isDecimal(value) {
+		return Rate{}, errInvalidRate
+	}
+
+	if v, ok := new(big.Rat).SetString(value); !ok || v.Sign() <= 0 {
+		return Rate{}, errInvalidRate
+	}
+
+	r.value, r.at = value, at.UTC()
+	return r, nil
+}
+
+func (r Rate) From() string {
+	return r.from.Symbol()
+}
+
+func (r Rate) To() string {
+	return r.to.Symbol()
+}
+
+// Value of Rate as decimal string, ie 1.0842
+func (r Rate) Value() string {
+	return r.value
+}
+
+// At tells since when Rate is valid.
+func (r Rate) At() time.Time {
+	return r.at
+}
+
+func (r Rate) IsZero() bool {
+	return r.value == ""
+}
+
+func (r Rate) String() string {
+	return fmt.Sprintf("%s/%s %s", r.from, r.to, r.value)
+}
+
+func (r Rate) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonRate{
+		From: r.From(),
+		To:   r.To(),
+		Rate: r.value,
+		At:   r.at,
+	})
+}
+
+func (r *Rate) UnmarshalJSON(b []byte) error {
+	if bytes.Equal(b, null) {
+		return nil
+	}
+
+	var j jsonRate
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+
+	if j.Rate == "" && j.From == "" && j.To == "" {
+		*r = Rate{}
+		return nil
+	}
+
+	n, err := NewRate(j.From, j.To, j.Rate, j.At)
+	if err != nil {
+		return err
+	}
+
+	*r = n
+	return nil
+}
+
+func (r Rate) GobEncode() ([]byte, error) {
+	return r.MarshalJSON()
+}
+
+func (r *Rate) GobDecode(b []byte) error {
+	return r.UnmarshalJSON(b)
+}
+
+func (r Rate) rat() *big.Rat {
+	v, _ := new(big.Rat).SetString(r.value)
+	return v
+}
+
+// Rates provides foreign exchange Rate of currency pair valid at given moment.
+type Rates interface {
+	Rate(from, to string, at time.Time) (Rate, error)
+}
+
+// Rounding tells how fraction of minor unit is handled during Money conversion.
+type Rounding int
+
+const (
+	HalfUp Rounding = iota
+	HalfEven
+	Up
+	Down
+)
+
+func NewRounding(name string) (Rounding, error) {
+	for r, n := range roundings {
+		if n == name {
+			return Rounding(r), nil
+		}
+	}
+
+	return 0, errInvalidRounding
+}
+
+func (r Rounding) String() string {
+	return roundings[r]
+}
+
+func (r Rounding) round(v *big.Rat) (*big.Int, bool) {
+	q, m := new(big.Int).QuoRem(v.Num(), v.Denom(), new(big.Int))
+	if m.Sign() == 0 {
+		return q, true
+	}
+
+	var s = big.NewInt(int64(v.Sign()))
+	var h = new(big.Int).Mul(new(big.Int).Abs(m), big.NewInt(2)).Cmp(v.Denom())
+
+	switch r {
+	case HalfUp:
+		if h >= 0 {
+			q.Add(q, s)
+		}
+	case HalfEven:
+		if h > 0 || (h == 0 && q.Bit(0) == 1) {
+			q.Add(q, s)
+		}
+	case Up:
+		q.Add(q, s)
+	case Down:
+	default:
+		return nil, false
+	}
+
+	return q, true
+}
+
+var roundings = []string{"half-up", "half-even", "up", "down"}
+
+// Convert Money into currency of Rate, fraction of target minor unit is
+// rounded with given Rounding.
+func (m Money) Convert(r Rate, rn Rounding) (Money, error) {
+	if r.IsZero() {
+		return Money{}, errInvalidRate
+	}
+
+	if m.currency != r.from {
+		return Money{}, CurrencyMismatchError{Expected: r.From(), Given: m.Symbol()}
+	}
+
+	v := new(big.Rat).SetFrac(
+		new(big.Int).Mul(big.NewInt(m.Minor()), pow10(r.to.Exponent())),
+		pow10(m.Exponent()),
+	)
+
+	n, ok := rn.round(v.Mul(v, r.rat()))
+	if !ok {
+		return Money{}, errInvalidRounding
+	}
+
+	if !n.IsInt64() {
+		return Money{}, errInvalidMoney
+	}
+
+	return Money{amount(n.Int64()), r.to}, nil
+}
+
+// Exchange is an audit record of Money conversion from presentment currency, in
+// which merchant priced goods, into settlement currency of the card.
+type Exchange struct {
+	Presentment Money
+	Settlement  Money
+	Rate        Rate
+}
+
+func NewExchange(m Money, r Rate, rn Rounding) (Exchange, error) {
+	s, err := m.Convert(r, rn)
+	if err != nil {
+		return Exchange{}, err
+	}
+
+	return Exchange{Presentment: m, Settlement: s, Rate: r}, nil
+}
+
+// newPartExchange converts part m of Money, which follows done part converted
+// already, as difference of conversions of totals before and after it. Rounded
+// parts so never add up to more than conversion of the whole.
+func newPartExchange(done, m Money, r Rate, rn Rounding) (Exchange, error) {
+	t, err := done.add(m)
+	if err != nil {
+		return Exchange{}, err
+	}
+
+	before, err := done.Convert(r, rn)
+	if err != nil {
+		return Exchange{}, err
+	}
+
+	after, err := t.Convert(r, rn)
+	if err != nil {
+		return Exchange{}, err
+	}
+
+	s, err := after.sub(before)
+	if err != nil {
+		return Exchange{}, err
+	}
+
+	return Exchange{Presentment: m, Settlement: s, Rate: r}, nil
+}
+
+func (x Exchange) String() string {
+	return fmt.Sprintf("%s -> %s (%s)", x.Presentment, x.Settlement, x.Rate)
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+func isDecimal(s string) bool {
+	i, f := s, ""
+	if p := strings.IndexByte(s, '.'); p != -1 {
+		i, f = s[:p], s[p+1:]
+	}
+
+	return i != "" && isDigits(i) && isDigits(f)
+}
+
+type jsonRate struct {
+	From, To, Rate string
+	At             time.Time
+}
+
+var (
+	errInvalidRate     = NewError(Validation, "invalid_rate", "exchange: invalid rate, expected positive decimal ie 1.0842")
+	errInvalidRounding = NewError(Validation, "invalid_rounding", "exchange: invalid rounding, expected one of %s", strings.Join(roundings, ", "))
+)
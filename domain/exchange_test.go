@@ -0,0 +1,57 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMoney_Convert(t *testing.T) {
+	type (
+		have struct {
+			amount, from, to, rate string
+			rounding               Rounding
+		}
+
+		want string
+
+		case_ struct {
+			description string
+			have
+			want
+		}
+	)
+
+	scenario := []case_{
+		{"10.00 EUR to USD", have{"10", "EUR", "USD", "1.0842", HalfUp}, "10.84USD"},
+		{"0.05 EUR to USD half up", have{"0.05", "EUR", "USD", "1.5", HalfUp}, "0.08USD"},
+		{"0.05 EUR to USD half even", have{"0.05", "EUR", "USD", "1.5", HalfEven}, "0.08USD"},
+		{"0.07 EUR to USD half even", have{"0.07", "EUR", "USD", "1.5", HalfEven}, "0.10USD"},
+		{"0.01 EUR to USD half even", have{"0.01", "EUR", "USD", "1.5", HalfEven}, "0.02USD"},
+		{"0.03 EUR to USD half even", have{"0.03", "EUR", "USD", "1.5", HalfEven}, "0.04USD"},
+		{"0.03 EUR to USD down", have{"0.03", "EUR", "USD", "1.5", Down}, "0.04USD"},
+		{"0.01 EUR to USD down", have{"0.01", "EUR", "USD", "1.9", Down}, "0.01USD"},
+		{"0.01 EUR to USD up", have{"0.01", "EUR", "USD", "1.1", Up}, "0.02USD"},
+		{"-0.01 EUR to USD up", have{"-0.01", "EUR", "USD", "1.1", Up}, "-0.02USD"},
+		{"100 JPY to USD", have{"100", "JPY", "USD", "0.0067", HalfUp}, "0.67USD"},
+		{"1.00 USD to JPY", have{"1", "USD", "JPY", "149.555", HalfUp}, "150JPY"},
+		{"1.00 USD to KWD", have{"1", "USD", "KWD", "0.3075", HalfEven}, "0.308KWD"},
+	}
+
+	for _, c := range scenario {
+		t.Run(c.description, func(t *testing.T) {
+			r, err := NewRate(c.have.from, c.have.to, c.have.rate, time.Now())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			m, err := newTestMoney(t, c.have.amount, c.have.from).Convert(r, c.have.rounding)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if s := want(m.String()); s != c.want {
+				t.Fatalf("expected:%v got:%v", c.want, s)
+			}
+		})
+	}
+}
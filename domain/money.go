@@ -8,11 +8,12 @@ import (
 	"strings"
 )
 
-// Money
+// Money is an exact amount held in minor units of its ISO 4217 currency.
 //
-// todo check currency when operations on multiple Money is performed
+// Comparison and arithmetic on Money of different currencies is rejected with
+// CurrencyMismatchError.
 type Money struct {
-	amount // todo find better solution as value object instead pointer
+	amount
 	currency
 }
 
@@ -22,55 +23,84 @@ func NewMoney(s, currency string) (Money, error) {
 		return Money{}, errInvalidMoney
 	}
 
-	f, err := strconv.ParseFloat(s, 64)
+	c, err := newCurrency(currency)
 	if err != nil {
-		return Money{}, errInvalidMoney
+		return Money{}, err
 	}
 
-	c, err := newCurrency(currency)
+	a, err := newAmount(s, c.Exponent())
 	if err != nil {
 		return Money{}, err
 	}
 
-	return Money{amount(f), c}, nil
+	return Money{a, c}, nil
 }
 
-func (m Money) greater(than Money) bool {
-	return m.Amount() > than.Amount()
+func (m Money) greater(than Money) (bool, error) {
+	if err := m.same(than); err != nil {
+		return false, err
+	}
+
+	return m.amount > than.amount, nil
+}
+
+func (m Money) lower(than Money) (bool, error) {
+	if err := m.same(than); err != nil {
+		return false, err
+	}
+
+	return m.amount < than.amount, nil
+}
+
+func (m Money) add(n Money) (Money, error) {
+	if err := m.same(n); err != nil {
+		return Money{}, err
+	}
+
+	return Money{m.amount + n.amount, m.currency}, nil
 }
 
-func (m Money) lower(than Money) bool {
-	return m.Amount() < than.Amount()
+func (m Money) sub(n Money) (Money, error) {
+	if err := m.same(n); err != nil {
+		return Money{}, err
+	}
+
+	return Money{m.amount - n.amount, m.currency}, nil
 }
 
-func (m Money) add(n Money) Money {
-	a := amount(m.Amount() + n.Amount())
-	return Money{a, m.currency}
+func (m Money) same(n Money) error {
+	if m.currency != n.currency {
+		return CurrencyMismatchError{Expected: m.Symbol(), Given: n.Symbol()}
+	}
+
+	return nil
 }
 
-func (m Money) sub(n Money) Money {
-	a := amount(m.Amount() - n.Amount())
-	return Money{a, m.currency}
+// Currency gives ISO 4217 code of Money.
+func (m Money) Currency() string {
+	return m.Symbol()
 }
 
 func (m Money) IsPositive() bool {
-	if m.IsZero() {
-		return false
-	}
-	return m.Amount() > 0
+	return m.amount > 0
 }
 
 func (m Money) IsZero() bool {
-	return m.Amount() == 0
+	return m.amount == 0
+}
+
+// Amount gives decimal representation of Money, ie 149.99 for USD or 150 for JPY.
+func (m Money) Amount() string {
+	return m.amount.format(m.Exponent())
 }
 
 func (m Money) String() string {
-	return fmt.Sprintf("%s%s", m.amount, m.currency)
+	return fmt.Sprintf("%s%s", m.Amount(), m.currency)
 }
 
 func (m Money) MarshalJSON() ([]byte, error) {
 	return json.Marshal(jsonMoney{
-		Amount:   m.amount.String(),
+		Amount:   m.Amount(),
 		Currency: m.currency.Symbol(),
 	})
 }
@@ -85,6 +115,12 @@ func (m *Money) UnmarshalJSON(b []byte) error {
 		return err
 	}
 
+	// zero Money has no currency
+	if j.Currency == "" && (j.Amount == "" || j.Amount == "0") {
+		*m = Money{}
+		return nil
+	}
+
 	v, err := NewMoney(j.Amount, j.Currency)
 	if err != nil {
 		return err
@@ -94,36 +130,95 @@ func (m *Money) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
-type amount float64
+func (m Money) GobEncode() ([]byte, error) {
+	return m.MarshalJSON()
+}
 
-func (p amount) Pennies() int {
-	return int(p * 100)
+func (m *Money) GobDecode(b []byte) error {
+	return m.UnmarshalJSON(b)
 }
 
-func (p amount) Amount() float64 {
-	return float64(p)
+// amount of Money expressed in minor units of currency, ie cents for USD.
+type amount int64
+
+func newAmount(s string, exponent int) (amount, error) {
+	var negative bool
+	switch s[0] {
+	case '-':
+		negative, s = true, s[1:]
+	case '+':
+		s = s[1:]
+	}
+
+	i, f := s, ""
+	if p := strings.IndexByte(s, '.'); p != -1 {
+		i, f = s[:p], s[p+1:]
+	}
+
+	if (i == "" && f == "") || !isDigits(i) || !isDigits(f) {
+		return 0, errInvalidMoney
+	}
+
+	if len(f) > exponent {
+		return 0, errInvalidMoneyPrecision
+	}
+
+	n, err := strconv.ParseInt(i+f+strings.Repeat("0", exponent-len(f)), 10, 64)
+	if err != nil {
+		return 0, errInvalidMoney
+	}
+
+	if negative {
+		n = -n
+	}
+
+	return amount(n), nil
 }
 
-func (p amount) String() string {
-	return fmt.Sprintf("%.2f", p.Amount())
+func (p amount) Minor() int64 {
+	return int64(p)
 }
 
-type currency string
+func (p amount) format(exponent int) string {
+	var sign string
+	if p < 0 {
+		sign, p = "-", -p
+	}
+
+	s := strconv.FormatInt(int64(p), 10)
+	if exponent == 0 {
+		return sign + s
+	}
+
+	if len(s) <= exponent {
+		s = strings.Repeat("0", exponent-len(s)+1) + s
+	}
+
+	return sign + s[:len(s)-exponent] + "." + s[len(s)-exponent:]
+}
 
-func newCurrency(symbol string) (currency, error) {
-	if n := len([]rune(symbol)); n == 0 || n > 3 {
-		return "", errInvalidCurrency
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
 	}
 
-	return currency(strings.ToTitle(symbol)), nil
+	return true
+}
+
+// CurrencyMismatchError is returned when Money of Given currency is used where
+// Money of Expected currency is required.
+type CurrencyMismatchError struct {
+	Expected, Given string
 }
 
-func (p currency) Symbol() string {
-	return string(p)
+func (e CurrencyMismatchError) Error() string {
+	return fmt.Sprintf("%s, expected %s, got %s", errCurrencyMismatch, e.Expected, e.Given)
 }
 
-func (p currency) String() string {
-	return string(p)
+func (e CurrencyMismatchError) Unwrap() error {
+	return errCurrencyMismatch
 }
 
 type jsonMoney struct {
@@ -131,7 +226,9 @@ type jsonMoney struct {
 }
 
 var (
-	errInvalidMoney       = Err("money: invalid amount, expected ie 149.99 format")
-	errInvalidCurrency    = Err("money: invalid symbol, ie USD is expected")
-	errInsufficientAmount = Err("money: insufficient amount")
+	errInvalidMoney          = NewError(Validation, "invalid_amount", "money: invalid amount, expected ie 149.99 format")
+	errInvalidMoneyPrecision = NewError(Validation, "invalid_amount_precision", "money: invalid amount, too many decimal places for currency")
+	errInvalidCurrency       = NewError(Validation, "invalid_currency", "money: invalid symbol, ISO 4217 code ie USD is expected")
+	errInsufficientAmount    = NewError(Validation, "insufficient_amount", "money: insufficient amount")
+	errCurrencyMismatch      = NewError(Validation, "currency_mismatch", "money: currency mismatch")
 )
@@ -1,6 +1,8 @@
 package domain
 
 import (
+	"encoding/json"
+	"errors"
 	"testing"
 )
 
@@ -27,7 +29,14 @@ func TestNewMoney(t *testing.T) {
 		{" 3.99 GBP gives ok", have{"3.99", "gbp"}, nil},
 		{" 0.00 USD gives ok", have{" 0.00", "USD"}, nil},
 		{"-4.29 PLN gives ok", have{"-4.29", "PLN"}, nil},
-		{"88.35 CN¥ gives ok", have{"88.35", "CN¥"}, nil},
+		{"88.35 CNY gives ok", have{"88.35", "CNY"}, nil},
+		{"88.35 CN¥ gives error", have{"88.35", "CN¥"}, errInvalidCurrency},
+		{"  120 JPY gives ok", have{"120", "JPY"}, nil},
+		{"120.5 JPY gives error", have{"120.5", "JPY"}, errInvalidMoneyPrecision},
+		{"1.005 KWD gives ok", have{"1.005", "KWD"}, nil},
+		{"1.005 USD gives error", have{"1.005", "USD"}, errInvalidMoneyPrecision},
+		{"    . USD gives error", have{".", "USD"}, errInvalidMoney},
+		{" 1e10 USD gives error", have{"1e10", "USD"}, errInvalidMoney},
 	}
 
 	for _, c := range scenario {
@@ -38,3 +47,73 @@ func TestNewMoney(t *testing.T) {
 		})
 	}
 }
+
+func TestMoney_String(t *testing.T) {
+	type (
+		have struct {
+			amount, currency string
+		}
+
+		want string
+
+		case_ struct {
+			description string
+			have
+			want
+		}
+	)
+
+	scenario := []case_{
+		{"149.99 USD", have{"149.99", "usd"}, "149.99USD"},
+		{"149.9 USD", have{"149.9", "USD"}, "149.90USD"},
+		{".05 EUR", have{".05", "EUR"}, "0.05EUR"},
+		{"-0.5 GBP", have{"-0.5", "GBP"}, "-0.50GBP"},
+		{"1500 JPY", have{"1500", "JPY"}, "1500JPY"},
+		{"2.1 KWD", have{"2.1", "KWD"}, "2.100KWD"},
+	}
+
+	for _, c := range scenario {
+		t.Run(c.description, func(t *testing.T) {
+			m, err := NewMoney(c.have.amount, c.have.currency)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if s := want(m.String()); s != c.want {
+				t.Fatalf("expected:%v got:%v", c.want, s)
+			}
+		})
+	}
+}
+
+func TestMoney_JSON(t *testing.T) {
+	m, err := NewMoney("0.1", "USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var s = m
+	for i := 0; i < 9; i++ {
+		if s, err = s.add(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var n Money
+	if err = json.Unmarshal(b, &n); err != nil {
+		t.Fatal(err)
+	}
+
+	if n != s || n.Minor() != 100 {
+		t.Fatalf("expected:%v got:%v", s, n)
+	}
+
+	if _, err = n.add(Money{1, "EUR"}); !errors.Is(err, CurrencyMismatchError{"USD", "EUR"}) {
+		t.Fatalf("expected:currency mismatch got:%v", err)
+	}
+}
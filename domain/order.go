@@ -0,0 +1,79 @@
+package domain
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Order is merchant data attached to authorization: Reference unique for
+// merchant (ie order number), Metadata of bounded size and Descriptor shown on
+// cardholder statement. All of them are optional.
+type Order struct {
+	Reference  string
+	Metadata   map[string]string
+	Descriptor string
+}
+
+func NewOrder(reference string, metadata map[string]string, descriptor string) (Order, error) {
+	o := Order{
+		Reference:  strings.TrimSpace(reference),
+		Descriptor: strings.TrimSpace(descriptor),
+	}
+
+	if len(o.Reference) > 64 || strings.IndexFunc(o.Reference, unicode.IsControl) != -1 {
+		return Order{}, errOrderReference
+	}
+
+	if len(metadata) > maxMetadata {
+		return Order{}, errOrderMetadata
+	}
+
+	for k, v := range metadata {
+		if k == "" || len(k) > 40 || len(v) > 500 {
+			return Order{}, errOrderMetadata
+		}
+
+		if o.Metadata == nil {
+			o.Metadata = make(map[string]string, len(metadata))
+		}
+
+		o.Metadata[k] = v
+	}
+
+	if o.Descriptor != "" && !isDescriptor(o.Descriptor) {
+		return Order{}, errOrderDescriptor
+	}
+
+	return o, nil
+}
+
+func (o Order) IsZero() bool {
+	return o.Reference == "" && len(o.Metadata) == 0 && o.Descriptor == ""
+}
+
+// isDescriptor tells if s is 5 to 22 printable ASCII characters with at least
+// one letter, characters rejected by card networks are not allowed.
+func isDescriptor(s string) bool {
+	if len(s) < 5 || len(s) > 22 || strings.ContainsAny(s, `<>\'"*`) {
+		return false
+	}
+
+	var letter bool
+	for _, r := range s {
+		if r < ' ' || r > '~' {
+			return false
+		}
+
+		letter = letter || unicode.IsLetter(r)
+	}
+
+	return letter
+}
+
+const maxMetadata = 20
+
+var (
+	errOrderReference  = NewError(Validation, "invalid_merchant_reference", "order: merchant reference has to be at most 64 printable characters")
+	errOrderMetadata   = NewError(Validation, "invalid_metadata", "order: metadata is at most %d keys of 40 characters with values of 500 characters", maxMetadata)
+	errOrderDescriptor = NewError(Validation, "invalid_statement_descriptor", "order: statement descriptor has to be 5 to 22 ASCII characters with a letter, without <>\\'\"*")
+)
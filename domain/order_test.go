@@ -0,0 +1,50 @@
+package domain
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewOrder(t *testing.T) {
+	type (
+		have struct {
+			reference  string
+			metadata   map[string]string
+			descriptor string
+		}
+
+		want error
+
+		case_ struct {
+			description string
+			have
+			want
+		}
+	)
+
+	many := map[string]string{}
+	for i := 0; i <= maxMetadata; i++ {
+		many[strings.Repeat("k", i+1)] = "v"
+	}
+
+	scenario := []case_{
+		{"empty order gives ok", have{}, nil},
+		{"full order gives ok", have{"order-1234", map[string]string{"cart": "42"}, "ACME Shop"}, nil},
+		{"long reference gives error", have{strings.Repeat("r", 65), nil, ""}, errOrderReference},
+		{"control character in reference gives error", have{"order\n1", nil, ""}, errOrderReference},
+		{"too many metadata keys gives error", have{"", many, ""}, errOrderMetadata},
+		{"empty metadata key gives error", have{"", map[string]string{"": "v"}, ""}, errOrderMetadata},
+		{"long metadata value gives error", have{"", map[string]string{"k": strings.Repeat("v", 501)}, ""}, errOrderMetadata},
+		{"short descriptor gives error", have{"", nil, "ACME"}, errOrderDescriptor},
+		{"quoted descriptor gives error", have{"", nil, `"ACME" Shop`}, errOrderDescriptor},
+		{"numeric descriptor gives error", have{"", nil, "123456"}, errOrderDescriptor},
+	}
+
+	for _, c := range scenario {
+		t.Run(c.description, func(t *testing.T) {
+			if _, err := NewOrder(c.have.reference, c.have.metadata, c.have.descriptor); err != c.want {
+				t.Fatalf("expected:%v got:%v", c.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package domain
+
+// Processor is card network (acquirer and issuer) which approves or declines
+// money movements on cards, it returns Error of HardDecline or SoftDecline
+// Class when movement is refused.
+type Processor interface {
+	Authorize(CreditCard, Money) error
+	Verify(CreditCard, Money, Address) (Verification, error)
+	Increment(Card, Money) error
+	Reverse(Card, Money) error
+	Capture(Card, Money) error
+	Refund(Card, Money) error
+}
+
+// NewDecline gives Error of issuer response code, ie 05 do not honor or 51
+// insufficient funds.
+func NewDecline(response string) *Error {
+	for _, d := range declines {
+		if d.Response == response {
+			return d
+		}
+	}
+
+	return newDecline(HardDecline, response, "card_declined", "unknown reason")
+}
+
+func newDecline(c Class, response, code, reason string) *Error {
+	e := NewError(c, code, "card network: declined %s %s", response, reason)
+	e.Response = response
+
+	return e
+}
+
+var declines = []*Error{
+	newDecline(HardDecline, "01", "refer_to_issuer", "refer to card issuer"),
+	newDecline(HardDecline, "04", "pick_up_card", "pick up card"),
+	newDecline(HardDecline, "05", "do_not_honor", "do not honor"),
+	newDecline(HardDecline, "12", "invalid_transaction", "invalid transaction"),
+	newDecline(HardDecline, "13", "invalid_amount", "invalid amount"),
+	newDecline(HardDecline, "14", "invalid_card_number", "invalid card number"),
+	newDecline(SoftDecline, "19", "reenter_transaction", "re-enter transaction"),
+	newDecline(HardDecline, "41", "lost_card", "lost card"),
+	newDecline(HardDecline, "43", "stolen_card", "stolen card"),
+	newDecline(SoftDecline, "51", "insufficient_funds", "insufficient funds"),
+	errCreditCardExpired,
+	newDecline(HardDecline, "57", "not_permitted", "transaction not permitted to cardholder"),
+	newDecline(HardDecline, "59", "suspected_fraud", "suspected fraud"),
+	newDecline(SoftDecline, "61", "exceeds_amount_limit", "exceeds withdrawal amount limit"),
+	newDecline(HardDecline, "62", "restricted_card", "restricted card"),
+	newDecline(SoftDecline, "65", "exceeds_frequency_limit", "exceeds withdrawal frequency limit"),
+	newDecline(SoftDecline, "68", "processor_timeout", "response received too late"),
+	newDecline(SoftDecline, "91", "issuer_unavailable", "issuer unavailable"),
+	newDecline(SoftDecline, "96", "system_malfunction", "system malfunction"),
+	newDecline(HardDecline, "N7", "cvv_mismatch", "cvv mismatch"),
+}
@@ -0,0 +1,118 @@
+package domain
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// SnapshotVersion is schema version of Transaction snapshots, it has to be
+// incremented whenever state of Transaction changes shape, so older snapshots
+// are discarded and events replayed instead.
+const SnapshotVersion = 2
+
+// snapshot of committed state of Transaction, status is resolved on restore.
+type snapshot struct {
+	Version      int
+	Card         *Card `json:",omitempty"`
+	Order        Order
+	Verification Verification
+	Authorized   Money
+	Balance      Money
+	Captured     Money
+	Refunded     Money
+	Released     Money
+	Exchange     Exchange
+	ExpiresAt    time.Time
+	Captures     []Capture
+	Refunds      []Refund
+	Voided       bool
+	Expired      bool
+	Finalized    bool
+	Reversed     bool
+	Declined     bool
+	Verified     bool
+}
+
+// Snapshot of committed state of Transaction in schema of SnapshotVersion.
+func (a *Transaction) Snapshot() (int, []byte, error) {
+	s := snapshot{
+		Version:      a.version,
+		Order:        a.order,
+		Verification: a.verification,
+		Authorized:   a.authorized,
+		Balance:      a.balance,
+		Captured:     a.captured,
+		Refunded:     a.refunded,
+		Released:     a.released,
+		Exchange:     a.exchange,
+		ExpiresAt:    a.expiresAt,
+		Captures:     a.captures,
+		Refunds:      a.refunds,
+		Voided:       a.voided,
+		Expired:      a.expired,
+		Finalized:    a.finalized,
+		Reversed:     a.reversed,
+		Declined:     a.declined,
+		Verified:     a.verified,
+	}
+
+	if !a.card.IsZero() {
+		s.Card = &a.card
+	}
+
+	b, err := json.Marshal(s)
+	return SnapshotVersion, b, err
+}
+
+// Restore committed state of Transaction from snapshot b of schema, only
+// Transaction without events can be restored.
+func (a *Transaction) Restore(schema int, b []byte) error {
+	if schema != SnapshotVersion {
+		return errSnapshotVersion
+	}
+
+	if a.version != 0 || len(a.uncommitted) != 0 {
+		return errSnapshotRestore
+	}
+
+	var s snapshot
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+
+	n := Transaction{
+		id:           a.id,
+		version:      s.Version,
+		order:        s.Order,
+		verification: s.Verification,
+		authorized:   s.Authorized,
+		balance:      s.Balance,
+		captured:     s.Captured,
+		refunded:     s.Refunded,
+		released:     s.Released,
+		exchange:     s.Exchange,
+		expiresAt:    s.ExpiresAt,
+		captures:     s.Captures,
+		refunds:      s.Refunds,
+		voided:       s.Voided,
+		expired:      s.Expired,
+		finalized:    s.Finalized,
+		reversed:     s.Reversed,
+		declined:     s.Declined,
+		verified:     s.Verified,
+	}
+
+	if s.Card != nil {
+		n.card = *s.Card
+	}
+
+	n.status = n.resolve()
+	*a = n
+
+	return nil
+}
+
+var (
+	errSnapshotVersion = NewError(Validation, "snapshot_version", "snapshot: unsupported schema version")
+	errSnapshotRestore = NewError(Conflict, "snapshot_restore", "snapshot: transaction already has events")
+)
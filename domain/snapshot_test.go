@@ -0,0 +1,55 @@
+package domain
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestTransaction_Snapshot(t *testing.T) {
+	x := newTestTransaction(t, "USD")
+	for _, m := range []string{"10", "20"} {
+		if err := x.Capture(newTestMoney(t, m, "USD"), false, HalfUp, approve); err != nil {
+			t.Fatal(err)
+		}
+		commit(t, x)
+	}
+
+	if err := x.Refund(x.Captures()[1].ID, newTestMoney(t, "5", "USD"), HalfUp, approve); err != nil {
+		t.Fatal(err)
+	}
+	commit(t, x)
+
+	v, b, err := x.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, _ := NewTransaction(NewID(x.ID()))
+	if err = a.Restore(v, b); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, r, _ := a.Snapshot(); !bytes.Equal(r, b) || a.Status() != x.Status() || a.Version() != x.Version() {
+		t.Fatalf("expected:%s got:%s", b, r)
+	}
+
+	// restored Transaction takes commands as original one
+	if err = a.Refund(x.Captures()[1].ID, newTestMoney(t, "16", "USD"), HalfUp, approve); !errors.Is(err, errTxRefundExceeded) {
+		t.Fatalf("expected:%v got:%v", errTxRefundExceeded, err)
+	}
+
+	type case_ struct {
+		have int
+		want error
+	}
+
+	for _, c := range []case_{
+		{v + 1, errSnapshotVersion},
+		{v, errSnapshotRestore},
+	} {
+		if err = a.Restore(c.have, b); !errors.Is(err, c.want) {
+			t.Fatalf("expected:%v got:%v", c.want, err)
+		}
+	}
+}
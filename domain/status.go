@@ -0,0 +1,53 @@
+package domain
+
+// Status of Transaction, it is resolved from events, so it never disagrees
+// with balances.
+type Status string
+
+const (
+	Authorized        Status = "authorized"
+	PartiallyCaptured Status = "partially_captured"
+	Captured          Status = "captured"
+	PartiallyRefunded Status = "partially_refunded"
+	Refunded          Status = "refunded"
+	Voided            Status = "voided"
+	Expired           Status = "expired"
+	Declined          Status = "declined"
+	Verified          Status = "verified"
+
+	// initial is Status of Transaction without any event.
+	initial Status = ""
+)
+
+func (s Status) String() string {
+	return string(s)
+}
+
+// operation is a command of Transaction which changes its Status.
+type operation string
+
+const (
+	authorizing  operation = "authorize"
+	verifying    operation = "verify"
+	incrementing operation = "increment"
+	voiding      operation = "void"
+	capturing    operation = "capture"
+	reversing    operation = "reverse"
+	refunding    operation = "refund"
+	expiring     operation = "expire"
+)
+
+// transitions declares operations allowed in each Status, amounts are checked
+// by commands themselves. Declined authorization can be retried.
+var transitions = map[Status][]operation{
+	initial:           {authorizing, verifying},
+	Declined:          {authorizing, verifying},
+	Authorized:        {incrementing, voiding, capturing, reversing, expiring},
+	PartiallyCaptured: {incrementing, capturing, reversing, refunding, expiring},
+	Captured:          {refunding},
+	PartiallyRefunded: {refunding},
+	Refunded:          {},
+	Voided:            {voiding},
+	Expired:           {},
+	Verified:          {},
+}
@@ -1,6 +1,7 @@
 package domain
 
 import (
+	"errors"
 	"time"
 
 	gonanoid "github.com/matoous/go-nanoid"
@@ -12,14 +13,31 @@ import (
 // to deliver consistency for customer.
 //
 // I did assumption that:
-// CreditCard can be stored in payment gateway.
+// Only PCI safe Card is stored in payment gateway, CreditCard cvv is used
+// during authorization and discarded.
 // Payment Gateway itself manages bank accounts
 type Transaction struct {
-	id         ID
-	card       CreditCard
-	authorized Money
-	balance    Money
-	voided     bool
+	id           ID
+	version      int
+	status       Status
+	card         Card
+	order        Order
+	verification Verification
+	authorized   Money
+	balance      Money
+	captured     Money
+	refunded     Money
+	released     Money
+	exchange     Exchange
+	expiresAt    time.Time
+	captures     []Capture
+	refunds      []Refund
+	voided       bool
+	expired      bool
+	finalized    bool
+	reversed     bool
+	declined     bool
+	verified     bool
 
 	uncommitted []Event
 }
@@ -32,86 +50,426 @@ func (a *Transaction) ID() string {
 	return string(a.id)
 }
 
-func (a *Transaction) Authorize(c CreditCard, m Money) error {
+// Version is number of committed events, it is expected version of stream
+// when uncommitted events are written.
+func (a *Transaction) Version() int {
+	return a.version
+}
+
+// Authorize holds Money on CreditCard until expiresAt, then uncaptured part of
+// it is released by Expire. Declined authorization is recorded, so it has to be
+// written even though error is returned.
+func (a *Transaction) Authorize(c CreditCard, x Exchange, expiresAt time.Time, o Order, p Processor) error {
+	e, err := a.authorize(c, x, expiresAt, o, p)
+	if err != nil {
+		return err
+	}
+
+	return a.append(e)
+}
+
+// Sale authorizes and captures whole Money at once. When capture fails the
+// authorization is reversed, so no hold is left on card, or when even reversal
+// fails it is kept and errTxHoldPending tells it has to be reversed, otherwise
+// it holds Money until Expire.
+func (a *Transaction) Sale(c CreditCard, x Exchange, expiresAt time.Time, o Order, p Processor) error {
+	e, err := a.authorize(c, x, expiresAt, o, p)
+	if err != nil {
+		return err
+	}
+
+	if err = p.Capture(e.Card, x.Settlement); err != nil {
+		if r := p.Reverse(e.Card, x.Settlement); r != nil {
+			a.append(e)
+			return Err("%w, capture failed due %s", errTxHoldPending, err)
+		}
+
+		a.append(e, TransactionReversed{x})
+		return err
+	}
+
+	return a.append(e, TransactionCaptured{x, newCaptureID(a.id, 1), 1, true})
+}
+
+// Verify CreditCard with zero Money, ie before it is saved for later payments.
+// Verified Transaction never holds Money, so it can not be captured.
+func (a *Transaction) Verify(c CreditCard, m Money, d Address, p Processor) error {
+	if err := a.allows(verifying); err != nil {
+		return err
+	}
+
 	switch {
-	case !a.authorized.IsZero():
-		return errTxAlreadyAuthorized
-	case !m.IsPositive():
-		return errInsufficientAmount
+	case m.Currency() == "", !m.IsZero():
+		return errTxVerificationAmount
 	case c.IsZero():
 		return errCreditCard
 	case c.IsExpired():
+		return a.decline(c.Card(), Exchange{Presentment: m, Settlement: m}, errCreditCardExpired)
+	}
+
+	v, err := p.Verify(c, m, d)
+	if err != nil {
+		return a.decline(c.Card(), Exchange{Presentment: m, Settlement: m}, err)
+	}
+
+	return a.append(CardVerified{c.Card(), m, v})
+}
+
+// IncrementAuthorization raises authorized amount, ie when hotel stay is
+// extended. Card is checked as in Authorize. Money is converted at Rate of
+// authorization, so its limit holds in Settlement currency as well.
+func (a *Transaction) IncrementAuthorization(m Money, rn Rounding, p Processor) error {
+	if err := a.allows(incrementing); err != nil {
+		return err
+	}
+
+	switch {
+	case a.isExpired(time.Now()):
+		return errTxAuthorizationExpired
+	case !m.IsPositive():
+		return errInsufficientAmount
+	case a.card.IsExpired():
 		return errCreditCardExpired
-	case c.number == cardFailures.auth:
-		return errCreditCardAuth
 	}
 
-	return a.append(TransactionAuthorized{c, m})
+	if err := a.authorized.same(m); err != nil {
+		return err
+	}
+
+	x, err := newPartExchange(a.authorized, m, a.exchange.Rate, rn)
+	if err != nil {
+		return err
+	}
+
+	if err = p.Increment(a.card, x.Settlement); err != nil {
+		return err
+	}
+
+	return a.append(TransactionAuthorizationIncremented{x})
 }
 
 func (a *Transaction) Void() error {
-	switch {
-	case a.voided:
-		return nil
-	case a.authorized.IsZero():
-		return errTxNotFound
-	case !a.authorized.sub(a.balance).IsZero():
-		return errTxVoidRejected
+	if err := a.allows(voiding); err != nil || a.status == Voided {
+		return err
+	}
+
+	if a.isExpired(time.Now()) {
+		return errTxAuthorizationExpired
 	}
 
 	return a.append(TransactionVoided{})
 }
 
-func (a *Transaction) Capture(m Money) error {
+// Capture part of authorized Money, many captures are possible until final one,
+// which releases remaining balance of authorization. Money is converted at
+// Rate of authorization, so card is never charged more than was held.
+func (a *Transaction) Capture(m Money, final bool, rn Rounding, p Processor) error {
+	if err := a.allows(capturing); err != nil {
+		return err
+	}
+
+	exceeded, err := a.balance.lower(m)
 	switch {
-	case a.authorized.IsZero():
-		return errTxNotFound
-	case a.card.number == cardFailures.capture:
-		return errCreditCardCapture
-	case a.voided:
-		return errTxVoided
-	case a.balance.lower(m):
+	case a.isExpired(time.Now()):
+		return errTxAuthorizationExpired
+	case err != nil:
+		return err
+	case exceeded:
 		return errTxCaptureExceeded
 	case !m.IsPositive():
 		return errInsufficientAmount
 	}
 
-	return a.append(TransactionCaptured{m})
+	x, err := a.settle(m, rn)
+	if err != nil {
+		return err
+	}
+
+	if err = p.Capture(a.card, x.Settlement); err != nil {
+		return err
+	}
+
+	r, err := a.balance.sub(m)
+	if err != nil {
+		return err
+	}
+
+	n := len(a.captures) + 1
+	c := TransactionCaptured{x, newCaptureID(a.id, n), n, final}
+	if !final || r.IsZero() {
+		return a.append(c)
+	}
+
+	return a.append(c, TransactionReleased{r})
+}
+
+// Reverse releases part or all of uncaptured balance, captures done so far are
+// not affected. Fully reversed authorization can not be captured anymore.
+// Money is converted at Rate of authorization as Capture does.
+func (a *Transaction) Reverse(m Money, rn Rounding, p Processor) error {
+	if err := a.allows(reversing); err != nil {
+		return err
+	}
+
+	exceeded, err := a.balance.lower(m)
+	switch {
+	case a.isExpired(time.Now()):
+		return errTxAuthorizationExpired
+	case err != nil:
+		return err
+	case exceeded:
+		return errTxReversalExceeded
+	case !m.IsPositive():
+		return errInsufficientAmount
+	}
+
+	x, err := a.settle(m, rn)
+	if err != nil {
+		return err
+	}
+
+	if err = p.Reverse(a.card, x.Settlement); err != nil {
+		return err
+	}
+
+	return a.append(TransactionReversed{x})
 }
 
-func (a *Transaction) Refund(m Money) error {
+// Refund part of Capture of given ID, which can be omitted when there is only
+// one Capture. Money is converted at Rate of Capture as difference of totals
+// refunded before and after, so card gets back what it was charged. Refunded
+// amount never returns to authorization balance.
+func (a *Transaction) Refund(capture ID, m Money, rn Rounding, p Processor) error {
+	if err := a.allows(refunding); err != nil {
+		return err
+	}
+
+	c, err := a.capture(capture)
+	if err != nil {
+		return err
+	}
+
+	r, err := c.Refundable()
+	if err != nil {
+		return err
+	}
+
+	exceeded, err := r.lower(m)
 	switch {
-	case a.authorized.IsZero():
-		return errTxNotFound
-	case a.card.number == cardFailures.refund:
-		return errCreditCardRefund
-	case a.voided:
-		return errTxVoided
-	case a.authorized.sub(a.balance).lower(m):
+	case err != nil:
+		return err
+	case exceeded:
 		return errTxRefundExceeded
 	case !m.IsPositive():
 		return errInsufficientAmount
 	}
 
-	return a.append(TransactionRefunded{m})
+	x, err := newPartExchange(c.Refunded, m, c.Rate, rn)
+	if err != nil {
+		return err
+	}
+
+	// card never gets back more than Capture charged, the last refund gives
+	// back all that is left of it
+	left, err := a.unrefunded(c)
+	if err != nil {
+		return err
+	}
+
+	if exceeded, err = left.lower(x.Settlement); err != nil {
+		return err
+	}
+
+	if exceeded || m == r {
+		x.Settlement = left
+	}
+
+	if err = p.Refund(a.card, x.Settlement); err != nil {
+		return err
+	}
+
+	return a.append(TransactionRefunded{x, newRefundID(a.id, len(a.refunds)+1), c.ID})
+}
+
+// unrefunded part of Settlement of Capture, refunds recorded without
+// settlement are not known to take any of it.
+func (a *Transaction) unrefunded(c *Capture) (Money, error) {
+	left := c.Settlement
+	for _, r := range a.refunds {
+		if r.Capture != c.ID || r.Settlement.IsZero() {
+			continue
+		}
+
+		var err error
+		if left, err = left.sub(r.Settlement); err != nil {
+			return Money{}, err
+		}
+	}
+
+	return left, nil
+}
+
+// settle converts m taken from balance at Rate of authorization, following
+// Money captured, reversed or released before, so settlement of all parts is
+// never more than was held.
+func (a *Transaction) settle(m Money, rn Rounding) (Exchange, error) {
+	done, err := a.authorized.sub(a.balance)
+	if err != nil {
+		return Exchange{}, err
+	}
+
+	return newPartExchange(done, m, a.exchange.Rate, rn)
+}
+
+// Expire releases uncaptured balance of authorization which expired before
+// given moment, nothing happens when there is no valid authorization.
+func (a *Transaction) Expire(at time.Time) error {
+	if a.allows(expiring) != nil || !a.isExpired(at) {
+		return nil
+	}
+
+	return a.append(TransactionExpired{a.balance})
+}
+
+func (a *Transaction) Status() Status {
+	return a.status
+}
+
+// IsZero tells if nothing happened to Transaction yet.
+func (a *Transaction) IsZero() bool {
+	return a.status == initial
+}
+
+// Card tells PCI safe part of card which was authorized or verified.
+func (a *Transaction) Card() Card {
+	return a.card
+}
+
+// Order tells merchant data given on authorization.
+func (a *Transaction) Order() Order {
+	return a.order
+}
+
+// Verification tells results of card checks when Transaction is Verified.
+func (a *Transaction) Verification() Verification {
+	return a.verification
 }
 
 func (a *Transaction) Balance() Money {
 	return a.balance
 }
 
-func (a *Transaction) Commit(e Event, at time.Time) error {
+// Captured is total of all captures.
+func (a *Transaction) Captured() Money {
+	return a.captured
+}
+
+// Refunded is total of all refunds.
+func (a *Transaction) Refunded() Money {
+	return a.refunded
+}
+
+func (a *Transaction) Captures() []Capture {
+	return append([]Capture(nil), a.captures...)
+}
+
+func (a *Transaction) Refunds() []Refund {
+	return append([]Refund(nil), a.refunds...)
+}
+
+// Released is part of authorization which will never be captured.
+func (a *Transaction) Released() Money {
+	return a.released
+}
+
+// ExpiresAt tells when uncaptured authorization is released.
+func (a *Transaction) ExpiresAt() time.Time {
+	return a.expiresAt
+}
+
+// Settlement tells in which currency authorized card is charged.
+func (a *Transaction) Settlement() string {
+	return a.exchange.Settlement.Currency()
+}
+
+func (a *Transaction) Commit(e Event, at time.Time) (err error) {
 	switch e := e.(type) {
 	case TransactionAuthorized:
-		a.authorized, a.balance, a.card = e.Money, e.Money, e.CreditCard
+		a.authorized, a.balance, a.card = e.Presentment, e.Presentment, e.Card
+		a.captured = Money{0, e.Presentment.currency}
+		a.refunded = Money{0, e.Presentment.currency}
+		a.released = Money{0, e.Presentment.currency}
+		a.exchange, a.expiresAt, a.order = e.Exchange, e.ExpiresAt, e.Order
+	case TransactionAuthorizationIncremented:
+		if a.authorized, err = a.authorized.add(e.Presentment); err != nil {
+			return err
+		}
+
+		a.balance, err = a.balance.add(e.Presentment)
 	case TransactionCaptured:
-		a.balance = a.balance.sub(e.Money)
+		if a.balance, err = a.balance.sub(e.Presentment); err != nil {
+			return err
+		}
+
+		a.finalized = e.Final
+		a.captures = append(a.captures, Capture{
+			ID:         e.Capture,
+			Sequence:   e.Sequence,
+			Amount:     e.Presentment,
+			Settlement: e.Settlement,
+			Rate:       e.Rate,
+			Refunded:   Money{0, e.Presentment.currency},
+			Final:      e.Final,
+		})
+
+		a.captured, err = a.captured.add(e.Presentment)
 	case TransactionRefunded:
-		a.balance = a.balance.add(e.Money)
+		var c *Capture
+		if c, err = a.capture(e.Capture); err != nil {
+			return err
+		}
+
+		if c.Refunded, err = c.Refunded.add(e.Presentment); err != nil {
+			return err
+		}
+
+		a.refunds = append(a.refunds, Refund{ID: e.Refund, Capture: e.Capture, Amount: e.Presentment, Settlement: e.Settlement})
+		a.refunded, err = a.refunded.add(e.Presentment)
+	case TransactionDeclined:
+		a.declined = true
+	case CardVerified:
+		z := Money{0, e.Money.currency}
+		a.authorized, a.balance, a.captured, a.refunded, a.released = z, z, z, z, z
+		a.card, a.verification, a.verified = e.Card, e.Verification, true
 	case TransactionVoided:
 		a.voided = true
+	case TransactionReversed:
+		if a.balance, err = a.balance.sub(e.Presentment); err != nil {
+			return err
+		}
+
+		a.reversed = a.balance.IsZero()
+		a.released, err = a.released.add(e.Presentment)
+	case TransactionReleased:
+		if a.balance, err = a.balance.sub(e.Released); err != nil {
+			return err
+		}
+
+		a.released, err = a.released.add(e.Released)
+	case TransactionExpired:
+		a.expired = true
+		if a.balance, err = a.balance.sub(e.Released); err != nil {
+			return err
+		}
+
+		a.released, err = a.released.add(e.Released)
 	}
 
+	if err != nil {
+		return err
+	}
+
+	a.status, a.version = a.resolve(), a.version+1
 	return nil
 }
 
@@ -125,18 +483,157 @@ func (a *Transaction) Uncommitted(clear bool) []Event {
 	return a.uncommitted
 }
 
+func (a *Transaction) authorize(c CreditCard, x Exchange, expiresAt time.Time, o Order, p Processor) (TransactionAuthorized, error) {
+	if err := a.allows(authorizing); err != nil {
+		return TransactionAuthorized{}, err
+	}
+
+	switch {
+	case c.IsZero():
+		return TransactionAuthorized{}, errCreditCard
+	case !x.Presentment.IsPositive(), !x.Settlement.IsPositive():
+		return TransactionAuthorized{}, errInsufficientAmount
+	case !expiresAt.After(time.Now()):
+		return TransactionAuthorized{}, errTxExpiry
+	case c.IsExpired():
+		return TransactionAuthorized{}, a.decline(c.Card(), x, errCreditCardExpired)
+	}
+
+	if err := p.Authorize(c, x.Settlement); err != nil {
+		return TransactionAuthorized{}, a.decline(c.Card(), x, err)
+	}
+
+	return TransactionAuthorized{c.Card(), x, expiresAt, o}, nil
+}
+
+// allows operation in current Status, error of rejection tells why it is not.
+func (a *Transaction) allows(o operation) error {
+	for _, t := range transitions[a.status] {
+		if t == o {
+			return nil
+		}
+	}
+
+	switch a.status {
+	case initial:
+		return errTxNotFound
+	case Declined:
+		return errTxDeclined
+	case Voided:
+		return errTxVoided
+	case Verified:
+		return errTxVerified
+	case Expired:
+		return errTxAuthorizationExpired
+	}
+
+	switch {
+	case o == authorizing, o == verifying:
+		return errTxAlreadyAuthorized
+	case o == voiding:
+		return errTxVoidRejected
+	case o == refunding && len(a.captures) == 0:
+		return errTxNotCaptured
+	case o == refunding:
+		return errTxRefundExceeded
+	case a.expired:
+		return errTxAuthorizationExpired
+	case a.reversed:
+		return errTxReversed
+	case a.finalized:
+		return errTxCaptureFinalized
+	}
+
+	return errTxCaptureExceeded
+}
+
+// resolve Status from state, uncaptured balance keeps authorization open even
+// when some of captures are refunded.
+func (a *Transaction) resolve() Status {
+	switch {
+	case a.voided:
+		return Voided
+	case a.verified:
+		return Verified
+	case a.authorized.IsZero() && a.declined:
+		return Declined
+	case a.authorized.IsZero():
+		return initial
+	case a.balance.IsPositive() && len(a.captures) == 0:
+		return Authorized
+	case a.balance.IsPositive():
+		return PartiallyCaptured
+	case len(a.captures) == 0 && a.expired:
+		return Expired
+	case len(a.captures) == 0:
+		// fully reversed authorization is the same as voided one
+		return Voided
+	case a.refunded.IsZero():
+		return Captured
+	case a.refunded != a.captured:
+		return PartiallyRefunded
+	}
+
+	return Refunded
+}
+
+// decline records failed authorization when card network declined it, other
+// failures are not recorded.
+func (a *Transaction) decline(c Card, x Exchange, err error) error {
+	var e *Error
+	if errors.As(err, &e) && (e.Class == HardDecline || e.Class == SoftDecline) {
+		a.append(TransactionDeclined{c, x, e})
+	}
+
+	return err
+}
+
+func (a *Transaction) capture(id ID) (*Capture, error) {
+	if id == "" {
+		if len(a.captures) != 1 {
+			return nil, errTxCaptureRequired
+		}
+
+		return &a.captures[0], nil
+	}
+
+	for i := range a.captures {
+		if a.captures[i].ID == id {
+			return &a.captures[i], nil
+		}
+	}
+
+	return nil, errTxCaptureNotFound
+}
+
+func (a *Transaction) isExpired(at time.Time) bool {
+	return a.expired || (!a.expiresAt.IsZero() && !at.Before(a.expiresAt))
+}
+
 func (a *Transaction) append(events ...Event) error {
 	a.uncommitted = append(a.uncommitted, events...)
 	return nil
 }
 
 var (
-	errTxNotFound          = Err("transaction: not found")
-	errTxAlreadyAuthorized = Err("transaction: already authorized")
-	errTxVoidRejected      = Err("transaction: void rejected")
-	errTxCaptureExceeded   = Err("transaction: capture amount exceeded")
-	errTxRefundExceeded    = Err("transaction: refund amount exceeded")
-	errTxVoided            = Err("transaction: voided")
+	errTxNotFound             = NewError(NotFound, "transaction_not_found", "transaction: not found")
+	errTxAlreadyAuthorized    = NewError(Conflict, "transaction_already_authorized", "transaction: already authorized")
+	errTxVoidRejected         = NewError(Conflict, "transaction_void_rejected", "transaction: void rejected")
+	errTxCaptureExceeded      = NewError(Validation, "capture_amount_exceeded", "transaction: capture amount exceeded")
+	errTxRefundExceeded       = NewError(Validation, "refund_amount_exceeded", "transaction: refund amount exceeded")
+	errTxVoided               = NewError(Conflict, "transaction_voided", "transaction: voided")
+	errTxExpiry               = NewError(Validation, "invalid_authorization_expiry", "transaction: authorization expiry has to be in future")
+	errTxAuthorizationExpired = NewError(Conflict, "authorization_expired", "transaction: authorization expired")
+	errTxCaptureFinalized     = NewError(Conflict, "capture_finalized", "transaction: final capture already done")
+	errTxReversalExceeded     = NewError(Validation, "reversal_amount_exceeded", "transaction: reversal amount exceeded")
+	errTxReversed             = NewError(Conflict, "transaction_reversed", "transaction: authorization fully reversed")
+	errTxCaptureRequired      = NewError(Validation, "capture_required", "transaction: capture of refund has to be given")
+	errTxCaptureNotFound      = NewError(NotFound, "capture_not_found", "transaction: capture not found")
+	errTxNotCaptured          = NewError(Conflict, "transaction_not_captured", "transaction: nothing captured to refund")
+	errTxDeclined             = NewError(Conflict, "transaction_declined", "transaction: authorization declined")
+	errTxHoldPending          = NewError(Conflict, "hold_pending_release", "transaction: authorization holds money until reversed")
+	errTxVerified             = NewError(Conflict, "transaction_verified", "transaction: card verification holds no money")
+	errTxVerificationAmount   = NewError(Validation, "invalid_verification_amount", "transaction: verification amount has to be zero")
 )
 
 type ID string
@@ -149,22 +646,66 @@ func NewID(s ...string) ID {
 	return ID(gonanoid.MustID(20))
 }
 
+// Events are written as JSON, so they embed only types without MarshalJSON,
+// which would be promoted and encode whole event.
 type (
 	Event = interface{}
 
 	TransactionAuthorized struct {
-		CreditCard
-		Money
+		Card Card
+		Exchange
+		ExpiresAt time.Time
+		Order     Order
+	}
+
+	// TransactionDeclined records authorization declined by card network.
+	TransactionDeclined struct {
+		Card Card
+		Exchange
+		Decline *Error
+	}
+
+	// CardVerified records zero Money authorization with results of card checks.
+	CardVerified struct {
+		Card  Card
+		Money Money
+		Verification
+	}
+
+	TransactionAuthorizationIncremented struct {
+		Exchange
 	}
 
 	TransactionVoided struct {
 	}
 
+	// TransactionCaptured is Sequence-th capture, Final one is the last.
 	TransactionCaptured struct {
-		Money
+		Exchange
+		Capture  ID
+		Sequence int
+		Final    bool
 	}
 
+	// TransactionReleased releases balance which remained after final capture.
+	TransactionReleased struct {
+		Released Money
+	}
+
+	// TransactionReversed releases part of uncaptured balance.
+	TransactionReversed struct {
+		Exchange
+	}
+
+	// TransactionRefunded returns part of Capture to card at its Rate.
 	TransactionRefunded struct {
-		Money
+		Exchange
+		Refund  ID
+		Capture ID
+	}
+
+	// TransactionExpired releases uncaptured balance of authorization.
+	TransactionExpired struct {
+		Released Money
 	}
 )
@@ -0,0 +1,727 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTransaction_Currency(t *testing.T) {
+	type (
+		have struct {
+			command  func(*Transaction, Money) error
+			currency string
+		}
+
+		want error
+
+		case_ struct {
+			description string
+			have
+			want
+		}
+	)
+
+	capture := func(t *Transaction, m Money) error { return t.Capture(m, false, HalfUp, approve) }
+	refund := func(t *Transaction, m Money) error { return t.Refund("", m, HalfUp, approve) }
+	mismatch := CurrencyMismatchError{"USD", "EUR"}
+
+	scenario := []case_{
+		{"capture in USD gives ok", have{capture, "USD"}, nil},
+		{"capture in EUR gives error", have{capture, "EUR"}, mismatch},
+		{"refund in USD gives ok", have{refund, "USD"}, nil},
+		{"refund in EUR gives error", have{refund, "EUR"}, mismatch},
+	}
+
+	for _, c := range scenario {
+		t.Run(c.description, func(t *testing.T) {
+			x := newTestTransaction(t, "USD")
+			if err := x.Capture(newTestMoney(t, "10", "USD"), false, HalfUp, approve); err != nil {
+				t.Fatal(err)
+			}
+			commit(t, x)
+
+			if err := c.have.command(x, newTestMoney(t, "5", c.have.currency)); !errors.Is(err, c.want) {
+				t.Fatalf("expected:%v got:%v", c.want, err)
+			}
+		})
+	}
+}
+
+func newTestTransaction(t *testing.T, currency string) *Transaction {
+	c, err := NewCreditCard("Tom", "4000000000000044", "12/2099", "884")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	x, err := NewTransaction(NewID())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = x.Authorize(c, newTestExchange(t, "100", currency), time.Now().Add(time.Hour), Order{}, approve); err != nil {
+		t.Fatal(err)
+	}
+
+	commit(t, x)
+	return x
+}
+
+func newTestMoney(t *testing.T, amount, currency string) Money {
+	m, err := NewMoney(amount, currency)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return m
+}
+
+func newTestExchange(t *testing.T, amount, currency string) Exchange {
+	r, err := NewRate(currency, currency, "1", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	x, err := NewExchange(newTestMoney(t, amount, currency), r, HalfUp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return x
+}
+
+func commit(t *testing.T, x *Transaction) {
+	for _, e := range x.Uncommitted(true) {
+		if err := x.Commit(e, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// processor responds with the same error to every request.
+type processor struct{ err error }
+
+func (p processor) Authorize(CreditCard, Money) error { return p.err }
+func (p processor) Verify(CreditCard, Money, Address) (Verification, error) {
+	return Verification{Matched, Matched}, p.err
+}
+func (p processor) Increment(Card, Money) error { return p.err }
+func (p processor) Reverse(Card, Money) error   { return p.err }
+func (p processor) Capture(Card, Money) error   { return p.err }
+func (p processor) Refund(Card, Money) error    { return p.err }
+
+var approve = processor{}
+
+func TestTransaction_IncrementAuthorization(t *testing.T) {
+	x := newTestTransaction(t, "USD")
+	if err := x.Capture(newTestMoney(t, "100.01", "USD"), false, HalfUp, approve); err != errTxCaptureExceeded {
+		t.Fatalf("expected:%v got:%v", errTxCaptureExceeded, err)
+	}
+
+	if err := x.IncrementAuthorization(newTestMoney(t, "50", "EUR"), HalfUp, approve); !errors.Is(err, errCurrencyMismatch) {
+		t.Fatalf("expected:%v got:%v", errCurrencyMismatch, err)
+	}
+
+	d := NewDecline("51")
+	if err := x.IncrementAuthorization(newTestMoney(t, "50", "USD"), HalfUp, processor{d}); err != d {
+		t.Fatalf("expected:%v got:%v", d, err)
+	}
+
+	if err := x.IncrementAuthorization(newTestMoney(t, "50", "USD"), HalfUp, approve); err != nil {
+		t.Fatal(err)
+	}
+	commit(t, x)
+
+	if err := x.Capture(newTestMoney(t, "150", "USD"), false, HalfUp, approve); err != nil {
+		t.Fatal(err)
+	}
+	commit(t, x)
+
+	if !x.Balance().IsZero() {
+		t.Fatalf("expected:zero balance got:%v", x.Balance())
+	}
+}
+
+func TestTransaction_Authorize(t *testing.T) {
+	c, err := NewCreditCard("Tom", "4000000000000044", "12/2099", "884")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := time.Now()
+	for _, x := range []struct {
+		case_     string
+		card      CreditCard
+		expiresAt time.Time
+		want      error
+	}{
+		// card is validated before expiry which depends on its brand
+		{"no card", CreditCard{}, n, errCreditCard},
+		{"no hold", c, n, errTxExpiry},
+		{"held", c, n.Add(time.Hour), nil},
+	} {
+		a, _ := NewTransaction(NewID())
+		if err = a.Authorize(x.card, newTestExchange(t, "10", "USD"), x.expiresAt, Order{}, approve); err != x.want {
+			t.Fatalf("%s expected:%v got:%v", x.case_, x.want, err)
+		}
+	}
+}
+
+func TestTransaction_Expire(t *testing.T) {
+	x := newTestTransaction(t, "USD")
+	if err := x.Capture(newTestMoney(t, "30", "USD"), false, HalfUp, approve); err != nil {
+		t.Fatal(err)
+	}
+	commit(t, x)
+
+	if err := x.Expire(time.Now()); err != nil || len(x.Uncommitted(false)) != 0 {
+		t.Fatalf("expected no expiry before %s got:%v", x.ExpiresAt(), err)
+	}
+
+	if err := x.Expire(x.ExpiresAt()); err != nil {
+		t.Fatal(err)
+	}
+	commit(t, x)
+
+	if e := newTestMoney(t, "0", "USD"); x.Balance() != e {
+		t.Fatalf("expected:%v got:%v", e, x.Balance())
+	}
+
+	if err := x.Capture(newTestMoney(t, "10", "USD"), false, HalfUp, approve); err != errTxAuthorizationExpired {
+		t.Fatalf("expected:%v got:%v", errTxAuthorizationExpired, err)
+	}
+
+	if err := x.Refund("", newTestMoney(t, "30.01", "USD"), HalfUp, approve); err != errTxRefundExceeded {
+		t.Fatalf("expected:%v got:%v", errTxRefundExceeded, err)
+	}
+
+	if err := x.Refund("", newTestMoney(t, "30", "USD"), HalfUp, approve); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTransaction_Capture(t *testing.T) {
+	x := newTestTransaction(t, "USD")
+	for _, m := range []string{"10", "20"} {
+		if err := x.Capture(newTestMoney(t, m, "USD"), false, HalfUp, approve); err != nil {
+			t.Fatal(err)
+		}
+		commit(t, x)
+	}
+
+	if err := x.Capture(newTestMoney(t, "30", "USD"), true, HalfUp, approve); err != nil {
+		t.Fatal(err)
+	}
+
+	e := x.Uncommitted(false)
+	if c, ok := e[0].(TransactionCaptured); len(e) != 2 || !ok || c.Sequence != 3 || !c.Final {
+		t.Fatalf("expected third final capture and release got:%v", e)
+	}
+	commit(t, x)
+
+	type want struct{ available, captured, released Money }
+	if out, w := (want{x.Balance(), x.Captured(), x.Released()}), (want{
+		newTestMoney(t, "0", "USD"),
+		newTestMoney(t, "60", "USD"),
+		newTestMoney(t, "40", "USD"),
+	}); out != w {
+		t.Fatalf("expected:%v got:%v", w, out)
+	}
+
+	if err := x.Capture(newTestMoney(t, "1", "USD"), false, HalfUp, approve); err != errTxCaptureFinalized {
+		t.Fatalf("expected:%v got:%v", errTxCaptureFinalized, err)
+	}
+
+	if err := x.Refund(newCaptureID(x.id, 3), newTestMoney(t, "30.01", "USD"), HalfUp, approve); err != errTxRefundExceeded {
+		t.Fatalf("expected:%v got:%v", errTxRefundExceeded, err)
+	}
+}
+
+func TestTransaction_Refund(t *testing.T) {
+	x := newTestTransaction(t, "USD")
+	for _, m := range []string{"10", "20"} {
+		if err := x.Capture(newTestMoney(t, m, "USD"), false, HalfUp, approve); err != nil {
+			t.Fatal(err)
+		}
+		commit(t, x)
+	}
+
+	first, second := newCaptureID(x.id, 1), newCaptureID(x.id, 2)
+
+	type (
+		have struct {
+			capture ID
+			amount  string
+		}
+
+		want error
+
+		case_ struct {
+			description string
+			have
+			want
+		}
+	)
+
+	scenario := []case_{
+		{"refund without capture gives error", have{"", "5"}, errTxCaptureRequired},
+		{"refund of unknown capture gives error", have{"x", "5"}, errTxCaptureNotFound},
+		{"refund above capture gives error", have{first, "10.01"}, errTxRefundExceeded},
+		{"refund of first capture gives ok", have{first, "6"}, nil},
+		{"refund above remainder gives error", have{first, "4.01"}, errTxRefundExceeded},
+		{"refund of remainder gives ok", have{first, "4"}, nil},
+		{"refund of second capture gives ok", have{second, "20"}, nil},
+	}
+
+	for _, c := range scenario {
+		if err := x.Refund(c.have.capture, newTestMoney(t, c.have.amount, "USD"), HalfUp, approve); err != c.want {
+			t.Fatalf("%s expected:%v got:%v", c.description, c.want, err)
+		}
+		commit(t, x)
+	}
+
+	if r := x.Refunds(); len(r) != 3 || r[2].ID != newRefundID(x.id, 3) || r[2].Capture != second {
+		t.Fatalf("expected three refunds got:%v", r)
+	}
+
+	type totals struct{ available, captured, refunded Money }
+	if out, w := (totals{x.Balance(), x.Captured(), x.Refunded()}), (totals{
+		newTestMoney(t, "70", "USD"),
+		newTestMoney(t, "30", "USD"),
+		newTestMoney(t, "30", "USD"),
+	}); out != w {
+		t.Fatalf("expected:%v got:%v", w, out)
+	}
+
+	if err := x.Void(); err != errTxVoidRejected {
+		t.Fatalf("expected:%v got:%v", errTxVoidRejected, err)
+	}
+}
+
+func TestTransaction_Reverse(t *testing.T) {
+	x := newTestTransaction(t, "USD")
+	if err := x.Capture(newTestMoney(t, "30", "USD"), false, HalfUp, approve); err != nil {
+		t.Fatal(err)
+	}
+	commit(t, x)
+
+	if err := x.Reverse(newTestMoney(t, "70.01", "USD"), HalfUp, approve); err != errTxReversalExceeded {
+		t.Fatalf("expected:%v got:%v", errTxReversalExceeded, err)
+	}
+
+	for _, m := range []string{"20", "50"} {
+		if err := x.Reverse(newTestMoney(t, m, "USD"), HalfUp, approve); err != nil {
+			t.Fatal(err)
+		}
+		commit(t, x)
+	}
+
+	if x.Captured() != newTestMoney(t, "30", "USD") || x.Released() != newTestMoney(t, "70", "USD") {
+		t.Fatalf("expected 30USD captured and 70USD released got:%v %v", x.Captured(), x.Released())
+	}
+
+	if err := x.Capture(newTestMoney(t, "1", "USD"), false, HalfUp, approve); err != errTxReversed {
+		t.Fatalf("expected:%v got:%v", errTxReversed, err)
+	}
+
+	if err := x.Refund("", newTestMoney(t, "30", "USD"), HalfUp, approve); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTransaction_Settlement(t *testing.T) {
+	c, err := NewCreditCard("Tom", "4000000000000044", "12/2099", "884")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewRate("EUR", "USD", "1.1", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exchange := func(amount string) Exchange {
+		x, err := NewExchange(newTestMoney(t, amount, "EUR"), r, HalfUp)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return x
+	}
+
+	x, _ := NewTransaction(NewID())
+	if err = x.Authorize(c, exchange("100"), time.Now().Add(time.Hour), Order{}, approve); err != nil {
+		t.Fatal(err)
+	}
+	commit(t, x)
+
+	// card network is always given Money in settlement currency
+	p := &settled{}
+	if err = x.Reverse(newTestMoney(t, "10", "USD"), HalfUp, p); !errors.Is(err, errCurrencyMismatch) {
+		t.Fatalf("expected:%v got:%v", errCurrencyMismatch, err)
+	}
+
+	if err = x.Reverse(newTestMoney(t, "10", "EUR"), HalfUp, p); err != nil {
+		t.Fatal(err)
+	}
+
+	e, ok := x.Uncommitted(false)[0].(TransactionReversed)
+	if w := newTestMoney(t, "11", "USD"); !ok || p.money != w || e.Settlement != w {
+		t.Fatalf("expected:%v got:%v %v", w, p.money, e)
+	}
+	commit(t, x)
+
+	// increment and capture are converted at rate of authorization
+	if err = x.IncrementAuthorization(newTestMoney(t, "20", "EUR"), HalfUp, p); err != nil {
+		t.Fatal(err)
+	}
+
+	if w := newTestMoney(t, "22", "USD"); p.money != w {
+		t.Fatalf("expected:%v got:%v", w, p.money)
+	}
+	commit(t, x)
+
+	if err = x.Capture(newTestMoney(t, "50", "EUR"), false, HalfUp, p); err != nil {
+		t.Fatal(err)
+	}
+
+	if w := newTestMoney(t, "55", "USD"); p.money != w {
+		t.Fatalf("expected:%v got:%v", w, p.money)
+	}
+	commit(t, x)
+
+	// refund is converted at rate of capture
+	if err = x.Refund("", newTestMoney(t, "20", "EUR"), HalfUp, p); err != nil {
+		t.Fatal(err)
+	}
+
+	f, ok := x.Uncommitted(false)[0].(TransactionRefunded)
+	if w := newTestMoney(t, "22", "USD"); !ok || p.money != w || f.Settlement != w || f.Rate != r {
+		t.Fatalf("expected:%v got:%v %v", w, p.money, f)
+	}
+	commit(t, x)
+
+	if w := newTestMoney(t, "22", "USD"); x.Refunds()[0].Settlement != w {
+		t.Fatalf("expected:%v got:%v", w, x.Refunds()[0])
+	}
+}
+
+func TestTransaction_Rounding(t *testing.T) {
+	c, err := NewCreditCard("Tom", "4000000000000044", "12/2099", "884")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewRate("USD", "EUR", "0.5", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cent := newTestMoney(t, "0.01", "USD")
+	for _, x := range []struct {
+		case_   string
+		command func(*Transaction, Processor) error
+		want    []string
+	}{
+		{"capture", func(a *Transaction, p Processor) error { return a.Capture(cent, false, HalfUp, p) }, []string{"0.01", "0", "0.01"}},
+		{"reverse", func(a *Transaction, p Processor) error { return a.Reverse(cent, HalfUp, p) }, []string{"0.01", "0", "0.01"}},
+	} {
+		// 0.03USD holds 0.02EUR, parts of it never settle more
+		a, _ := NewTransaction(NewID())
+		e, err := NewExchange(newTestMoney(t, "0.03", "USD"), r, HalfUp)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err = a.Authorize(c, e, time.Now().Add(time.Hour), Order{}, approve); err != nil {
+			t.Fatal(err)
+		}
+		commit(t, a)
+
+		for i, w := range x.want {
+			p := &settled{}
+			if err = x.command(a, p); err != nil {
+				t.Fatal(err)
+			}
+			commit(t, a)
+
+			if w := newTestMoney(t, w, "EUR"); p.money != w {
+				t.Fatalf("%s #%d expected:%v got:%v", x.case_, i+1, w, p.money)
+			}
+		}
+	}
+
+	// refunds give back what capture charged, never more
+	for _, x := range []struct {
+		case_    string
+		captures []string
+		want     []string
+	}{
+		{"whole", []string{"0.03"}, []string{"0.01", "0", "0.01"}},
+		{"rounded down", []string{"0.01", "0.01"}, []string{"0"}},
+	} {
+		a, _ := NewTransaction(NewID())
+		e, err := NewExchange(newTestMoney(t, "0.03", "USD"), r, HalfUp)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err = a.Authorize(c, e, time.Now().Add(time.Hour), Order{}, approve); err != nil {
+			t.Fatal(err)
+		}
+		commit(t, a)
+
+		for _, m := range x.captures {
+			if err = a.Capture(newTestMoney(t, m, "USD"), false, HalfUp, approve); err != nil {
+				t.Fatal(err)
+			}
+			commit(t, a)
+		}
+
+		id := a.Captures()[len(a.Captures())-1].ID
+		for i, w := range x.want {
+			p := &settled{}
+			if err = a.Refund(id, cent, HalfUp, p); err != nil {
+				t.Fatal(err)
+			}
+			commit(t, a)
+
+			if w := newTestMoney(t, w, "EUR"); p.money != w {
+				t.Fatalf("refund %s #%d expected:%v got:%v", x.case_, i+1, w, p.money)
+			}
+		}
+	}
+
+	// increments hold difference of totals as well
+	a, _ := NewTransaction(NewID())
+	e, err := NewExchange(cent, r, HalfUp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = a.Authorize(c, e, time.Now().Add(time.Hour), Order{}, approve); err != nil {
+		t.Fatal(err)
+	}
+	commit(t, a)
+
+	for i, w := range []string{"0", "0.01"} {
+		p := &settled{}
+		if err = a.IncrementAuthorization(cent, HalfUp, p); err != nil {
+			t.Fatal(err)
+		}
+		commit(t, a)
+
+		if w := newTestMoney(t, w, "EUR"); p.money != w {
+			t.Fatalf("increment #%d expected:%v got:%v", i+1, w, p.money)
+		}
+	}
+}
+
+// settled approves every request and keeps Money of the last one.
+type settled struct {
+	processor
+	money Money
+}
+
+func (p *settled) Increment(_ Card, m Money) error {
+	p.money = m
+	return nil
+}
+
+func (p *settled) Capture(_ Card, m Money) error {
+	p.money = m
+	return nil
+}
+
+func (p *settled) Reverse(_ Card, m Money) error {
+	p.money = m
+	return nil
+}
+
+func (p *settled) Refund(_ Card, m Money) error {
+	p.money = m
+	return nil
+}
+
+func TestTransaction_Status(t *testing.T) {
+	type (
+		have []func(*Transaction) error
+
+		want = Status
+
+		case_ struct {
+			description string
+			have
+			want
+		}
+	)
+
+	capture := func(amount string, final bool) func(*Transaction) error {
+		return func(x *Transaction) error {
+			return x.Capture(newTestMoney(t, amount, "USD"), final, HalfUp, approve)
+		}
+	}
+
+	refund := func(amount string) func(*Transaction) error {
+		return func(x *Transaction) error { return x.Refund("", newTestMoney(t, amount, "USD"), HalfUp, approve) }
+	}
+
+	reverse := func(amount string) func(*Transaction) error {
+		return func(x *Transaction) error { return x.Reverse(newTestMoney(t, amount, "USD"), HalfUp, approve) }
+	}
+
+	void := func(x *Transaction) error { return x.Void() }
+	expire := func(x *Transaction) error { return x.Expire(x.ExpiresAt()) }
+
+	scenario := []case_{
+		{"authorization gives authorized", have{}, Authorized},
+		{"capture gives partially captured", have{capture("30", false)}, PartiallyCaptured},
+		{"capture of balance gives captured", have{capture("100", false)}, Captured},
+		{"final capture gives captured", have{capture("30", true)}, Captured},
+		{"refund of open authorization gives partially captured", have{capture("30", false), refund("30")}, PartiallyCaptured},
+		{"refund gives partially refunded", have{capture("30", true), refund("10")}, PartiallyRefunded},
+		{"refund of capture gives refunded", have{capture("30", true), refund("30")}, Refunded},
+		{"void gives voided", have{void}, Voided},
+		{"reversal of balance gives voided", have{reverse("100")}, Voided},
+		{"expiry gives expired", have{expire}, Expired},
+		{"expiry after capture gives captured", have{capture("30", false), expire}, Captured},
+	}
+
+	for _, c := range scenario {
+		t.Run(c.description, func(t *testing.T) {
+			x := newTestTransaction(t, "USD")
+			for _, command := range c.have {
+				if err := command(x); err != nil {
+					t.Fatal(err)
+				}
+				commit(t, x)
+			}
+
+			if x.Status() != c.want {
+				t.Fatalf("expected:%v got:%v", c.want, x.Status())
+			}
+		})
+	}
+}
+
+func TestTransaction_Declined(t *testing.T) {
+	c, err := NewCreditCard("Tom", "4000000000000044", "12/2099", "884")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	x, _ := NewTransaction(NewID())
+	d := NewDecline("51")
+	if err = x.Authorize(c, newTestExchange(t, "100", "USD"), time.Now().Add(time.Hour), Order{}, processor{d}); err != d {
+		t.Fatalf("expected:%v got:%v", d, err)
+	}
+
+	if e := x.Uncommitted(false); len(e) != 1 || e[0].(TransactionDeclined).Decline != d {
+		t.Fatalf("expected declined event got:%v", e)
+	}
+	commit(t, x)
+
+	if x.Status() != Declined {
+		t.Fatalf("expected:%v got:%v", Declined, x.Status())
+	}
+
+	if err = x.Capture(newTestMoney(t, "10", "USD"), false, HalfUp, approve); err != errTxDeclined {
+		t.Fatalf("expected:%v got:%v", errTxDeclined, err)
+	}
+
+	if err = x.Authorize(c, newTestExchange(t, "100", "USD"), time.Now().Add(time.Hour), Order{}, approve); err != nil {
+		t.Fatal(err)
+	}
+	commit(t, x)
+
+	if x.Status() != Authorized {
+		t.Fatalf("expected:%v got:%v", Authorized, x.Status())
+	}
+
+	if x.Card() != c.Card() || x.Card().Masked() != "400000******0044" {
+		t.Fatalf("expected:%v got:%v", c.Card(), x.Card())
+	}
+}
+
+// failedCapture approves every request but capture.
+type failedCapture struct {
+	processor
+	capture, reverse error
+}
+
+func (p failedCapture) Capture(Card, Money) error { return p.capture }
+func (p failedCapture) Reverse(Card, Money) error { return p.reverse }
+
+func TestTransaction_Sale(t *testing.T) {
+	c, err := NewCreditCard("Tom", "4000000000000044", "12/2099", "884")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewDecline("91")
+
+	type (
+		have Processor
+
+		want struct {
+			err    error
+			status Status
+		}
+
+		case_ struct {
+			description string
+			have
+			want
+		}
+	)
+
+	scenario := []case_{
+		{"approved sale gives captured", approve, want{nil, Captured}},
+		{"declined authorization gives declined", processor{d}, want{d, Declined}},
+		{"failed capture gives reversed authorization", failedCapture{capture: d}, want{d, Voided}},
+		{"failed reversal gives authorization to reverse", failedCapture{capture: d, reverse: d}, want{errTxHoldPending, Authorized}},
+	}
+
+	for _, s := range scenario {
+		t.Run(s.description, func(t *testing.T) {
+			x, _ := NewTransaction(NewID())
+			if err := x.Sale(c, newTestExchange(t, "100", "USD"), time.Now().Add(time.Hour), Order{}, s.have); !errors.Is(err, s.want.err) {
+				t.Fatalf("expected:%v got:%v", s.want.err, err)
+			}
+			commit(t, x)
+
+			if x.Status() != s.want.status {
+				t.Fatalf("expected:%v got:%v", s.want.status, x.Status())
+			}
+		})
+	}
+}
+
+func TestTransaction_Verify(t *testing.T) {
+	c, err := NewCreditCard("Tom", "4000000000000044", "12/2099", "884")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	x, _ := NewTransaction(NewID())
+	if err = x.Verify(c, newTestMoney(t, "1", "USD"), Address{}, approve); err != errTxVerificationAmount {
+		t.Fatalf("expected:%v got:%v", errTxVerificationAmount, err)
+	}
+
+	if err = x.Verify(c, newTestMoney(t, "0", "USD"), Address{}, approve); err != nil {
+		t.Fatal(err)
+	}
+	commit(t, x)
+
+	if x.Status() != Verified || x.Verification() != (Verification{Matched, Matched}) {
+		t.Fatalf("expected verified card got:%v %v", x.Status(), x.Verification())
+	}
+
+	if !x.Balance().IsZero() || x.Balance().Currency() != "USD" {
+		t.Fatalf("expected:zero balance got:%v", x.Balance())
+	}
+
+	if err = x.Capture(newTestMoney(t, "1", "USD"), false, HalfUp, approve); err != errTxVerified {
+		t.Fatalf("expected:%v got:%v", errTxVerified, err)
+	}
+}
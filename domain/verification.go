@@ -0,0 +1,34 @@
+package domain
+
+import "strings"
+
+// Address of cardholder, it is checked by issuer during verification (AVS).
+type Address struct {
+	Line       string
+	PostalCode string
+}
+
+func (d Address) IsZero() bool {
+	return strings.TrimSpace(d.Line) == "" && strings.TrimSpace(d.PostalCode) == ""
+}
+
+// Check is result of comparing cardholder data with data known to issuer.
+type Check string
+
+const (
+	Matched    Check = "match"
+	Mismatched Check = "mismatch"
+	// Unchecked when data was not given or issuer does not support the check.
+	Unchecked Check = "unavailable"
+)
+
+// Verification is issuer response to zero amount authorization, CVV and AVS
+// results are informative, merchant decides whether card is saved.
+type Verification struct {
+	CVV Check
+	AVS Check
+}
+
+func (v Verification) IsZero() bool {
+	return v.CVV == "" && v.AVS == ""
+}
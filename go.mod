@@ -3,6 +3,7 @@ module payment
 go 1.17
 
 require (
-	github.com/gorilla/mux v1.8.0 // indirect
-	github.com/matoous/go-nanoid v1.5.0 // indirect
+	github.com/gorilla/mux v1.8.0
+	github.com/matoous/go-nanoid v1.5.0
+	github.com/mattn/go-sqlite3 v1.14.17
 )
@@ -0,0 +1,251 @@
+package infra
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"payment/domain"
+)
+
+// registry maps stable names and schema versions of events to Go types, so
+// events are persisted independently of Go type names.
+//
+// Payload of event is changed by registering its new type under the same name
+// with next version, type of previous version is kept with Upcaster, which
+// migrates its stored events to next version on read.
+type registry struct {
+	format    Format
+	schemas   map[reflect.Type]schema
+	types     map[schema]reflect.Type
+	upcasters map[schema]Upcaster
+	current   map[string]int
+}
+
+type schema struct {
+	name    string
+	version int
+}
+
+// Upcaster migrates event to next version of its schema.
+type Upcaster func(event) (event, error)
+
+func newRegistry(f Format) *registry {
+	return &registry{
+		format:    f,
+		schemas:   map[reflect.Type]schema{},
+		types:     map[schema]reflect.Type{},
+		upcasters: map[schema]Upcaster{},
+		current:   map[string]int{},
+	}
+}
+
+// register e as current version of name, versions start at 1.
+func (r *registry) register(name string, version int, e event) *registry {
+	s := schema{name, version}
+	t := reflect.TypeOf(e)
+	if _, ok := r.types[s]; ok || version < 1 {
+		panic(domain.Err("%w %s v%d", errRegistrySchema, name, version))
+	}
+
+	r.types[s] = t
+	r.schemas[t] = s
+	if version > r.current[name] {
+		r.current[name] = version
+	}
+
+	return r
+}
+
+// upcast events e of version of name with u to next one.
+func (r *registry) upcast(name string, version int, e event, u Upcaster) *registry {
+	r.register(name, version, e)
+	r.upcasters[schema{name, version}] = u
+
+	return r
+}
+
+// encode e in Format of registry, only current versions are encoded.
+func (r *registry) encode(e event) (string, int, []byte, error) {
+	s, ok := r.schemas[reflect.TypeOf(e)]
+	if !ok || s.version != r.current[s.name] {
+		return "", 0, nil, domain.Err("%w %T", errCodecEvent, e)
+	}
+
+	b, err := r.format.marshal(e)
+	return s.name, s.version, b, err
+}
+
+// decode event of name and version, Format is told by payload, so events
+// encoded in any of them are read. Records without version are of first one.
+func (r *registry) decode(name string, version int, b []byte) (event, error) {
+	if version == 0 {
+		version = 1
+	}
+
+	s := schema{name, version}
+	t, ok := r.types[s]
+	if !ok {
+		return nil, domain.Err("%w %s v%d", errCodecEvent, name, version)
+	}
+
+	f := JSON
+	if len(b) != 0 && b[0] == gobMark {
+		f = Gob
+	}
+
+	v := reflect.New(t)
+	if err := f.unmarshal(b, v.Interface()); err != nil {
+		return nil, err
+	}
+
+	e := v.Elem().Interface()
+	for version < r.current[name] {
+		u, ok := r.upcasters[s]
+		if !ok {
+			return nil, domain.Err("%w %s v%d", errRegistryUpcaster, name, version)
+		}
+
+		var err error
+		if e, err = u(e); err != nil {
+			return nil, err
+		}
+
+		version++
+		s = schema{name, version}
+	}
+
+	return e, nil
+}
+
+// Format of persisted events.
+type Format interface {
+	marshal(event) ([]byte, error)
+	unmarshal([]byte, interface{}) error
+}
+
+var (
+	// JSON Format is readable by other tools, it is default one.
+	JSON Format = jsonFormat{}
+	// Gob Format is binary one of encoding/gob.
+	Gob Format = gobFormat{}
+)
+
+// NewFormat parses json or gob.
+func NewFormat(s string) (Format, error) {
+	switch strings.ToLower(s) {
+	case "", "json":
+		return JSON, nil
+	case "gob", "binary":
+		return Gob, nil
+	}
+
+	return nil, domain.Err("%w %s", errRegistryFormat, s)
+}
+
+type jsonFormat struct{}
+
+func (jsonFormat) marshal(e event) ([]byte, error) {
+	return json.Marshal(e)
+}
+
+func (jsonFormat) unmarshal(b []byte, v interface{}) error {
+	return json.Unmarshal(b, v)
+}
+
+// gobFormat payload starts with gobMark byte, which is never first one of JSON.
+type gobFormat struct{}
+
+func (gobFormat) marshal(e event) ([]byte, error) {
+	b := bytes.NewBuffer([]byte{gobMark})
+	// gob can not encode struct without fields, ie TransactionVoided
+	if t := reflect.TypeOf(e); t.Kind() == reflect.Struct && t.NumField() == 0 {
+		return b.Bytes(), nil
+	}
+
+	err := gob.NewEncoder(b).Encode(e)
+	return b.Bytes(), err
+}
+
+func (gobFormat) unmarshal(b []byte, v interface{}) error {
+	if len(b) <= 1 {
+		return nil
+	}
+
+	return gob.NewDecoder(bytes.NewReader(b[1:])).Decode(v)
+}
+
+const gobMark = 0
+
+// payload of event as JSON value, JSON payload is embedded as is, binary one
+// as base64 string.
+type payload []byte
+
+func (p payload) MarshalJSON() ([]byte, error) {
+	if len(p) != 0 && p[0] == gobMark {
+		return json.Marshal([]byte(p))
+	}
+
+	return p, nil
+}
+
+func (p *payload) UnmarshalJSON(b []byte) error {
+	if len(b) != 0 && b[0] == '"' {
+		var v []byte
+		err := json.Unmarshal(b, &v)
+		*p = v
+		return err
+	}
+
+	*p = append((*p)[:0], b...)
+	return nil
+}
+
+// SetEventFormat in which events are written, events are read in any of them.
+// It has to be set before any Store is used.
+func SetEventFormat(f Format) {
+	events.format = f
+}
+
+// events of domain which are persisted, names must never change.
+var events = newRegistry(JSON).
+	register("TransactionAuthorized", 1, domain.TransactionAuthorized{}).
+	register("TransactionDeclined", 1, domain.TransactionDeclined{}).
+	register("CardVerified", 1, domain.CardVerified{}).
+	register("TransactionAuthorizationIncremented", 1, domain.TransactionAuthorizationIncremented{}).
+	register("TransactionVoided", 1, domain.TransactionVoided{}).
+	register("TransactionCaptured", 1, domain.TransactionCaptured{}).
+	register("TransactionReleased", 1, domain.TransactionReleased{}).
+	upcast("TransactionReversed", 1, transactionReversedV1{}, func(e event) (event, error) {
+		return domain.TransactionReversed{Exchange: domain.Exchange{Presentment: e.(transactionReversedV1).Money}}, nil
+	}).
+	register("TransactionReversed", 2, domain.TransactionReversed{}).
+	upcast("TransactionRefunded", 1, transactionRefundedV1{}, func(e event) (event, error) {
+		r := e.(transactionRefundedV1)
+		return domain.TransactionRefunded{Exchange: domain.Exchange{Presentment: r.Money}, Refund: r.Refund, Capture: r.Capture}, nil
+	}).
+	register("TransactionRefunded", 2, domain.TransactionRefunded{}).
+	register("TransactionExpired", 1, domain.TransactionExpired{})
+
+// transactionReversedV1 recorded presentment Money only, so settlement of such
+// reversal is unknown.
+type transactionReversedV1 struct {
+	Money domain.Money
+}
+
+// transactionRefundedV1 recorded presentment Money only, so settlement of such
+// refund is unknown.
+type transactionRefundedV1 struct {
+	Money   domain.Money
+	Refund  domain.ID
+	Capture domain.ID
+}
+
+var (
+	errCodecEvent       = domain.Err("codec: unknown event")
+	errRegistrySchema   = domain.Err("codec: invalid or duplicate schema")
+	errRegistryUpcaster = domain.Err("codec: missing upcaster")
+	errRegistryFormat   = domain.Err("codec: unknown format")
+)
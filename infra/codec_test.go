@@ -0,0 +1,174 @@
+package infra
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"payment/domain"
+)
+
+func TestCodec(t *testing.T) {
+	c, err := domain.NewCreditCard("Tom", "4000000000000044", "12/2099", "884")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := newTestMoney(t, "10", "USD")
+	r, err := domain.NewRate("USD", "EUR", "0.9", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	x, err := domain.NewExchange(m, r, domain.HalfUp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o, err := domain.NewOrder("order-1", map[string]string{"cart": "42"}, "ACME Shop")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, e := range []event{
+		domain.TransactionAuthorized{Card: c.Card(), Exchange: x, ExpiresAt: time.Now(), Order: o},
+		domain.TransactionDeclined{Card: c.Card(), Exchange: domain.Exchange{Presentment: m, Settlement: m}, Decline: domain.NewDecline("51")},
+		domain.CardVerified{Card: c.Card(), Money: m, Verification: domain.Verification{CVV: domain.Matched, AVS: domain.Unchecked}},
+		domain.TransactionAuthorizationIncremented{Exchange: x},
+		domain.TransactionVoided{},
+		domain.TransactionCaptured{Exchange: x, Capture: "a.c1", Sequence: 1, Final: true},
+		domain.TransactionReleased{Released: m},
+		domain.TransactionReversed{Exchange: x},
+		domain.TransactionRefunded{Exchange: x, Refund: "a.r1", Capture: "a.c1"},
+		domain.TransactionExpired{Released: m},
+	} {
+		for _, f := range []Format{JSON, Gob} {
+			r := *events
+			r.format = f
+			n, v, b, err := r.encode(e)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			d, err := r.decode(n, v, b)
+			if err != nil {
+				t.Fatalf("%s decode failed due %s", n, err)
+			}
+
+			if _, _, a, err := r.encode(d); err != nil || !bytes.Equal(a, b) {
+				t.Fatalf("expected:%x got:%x %v", b, a, err)
+			}
+		}
+	}
+
+	if _, _, _, err = events.encode(struct{}{}); !errors.Is(err, errCodecEvent) {
+		t.Fatalf("expected:%v got:%v", errCodecEvent, err)
+	}
+}
+
+func TestRegistry_Upcast(t *testing.T) {
+	type v1 struct{ Amount int }
+	type v2 struct{ Amount, Fee int }
+	type v3 struct {
+		Amount string
+		Fee    int
+	}
+
+	r := newRegistry(JSON).
+		upcast("Paid", 1, v1{}, func(e event) (event, error) {
+			return v2{Amount: e.(v1).Amount}, nil
+		}).
+		upcast("Paid", 2, v2{}, func(e event) (event, error) {
+			return v3{Amount: strconv.Itoa(e.(v2).Amount), Fee: e.(v2).Fee}, nil
+		}).
+		register("Paid", 3, v3{})
+
+	type case_ struct {
+		version int
+		have    string
+		want    event
+	}
+
+	for _, c := range []case_{
+		{0, `{"Amount":10}`, v3{Amount: "10"}},
+		{1, `{"Amount":10}`, v3{Amount: "10"}},
+		{2, `{"Amount":10,"Fee":1}`, v3{Amount: "10", Fee: 1}},
+		{3, `{"Amount":"10","Fee":1}`, v3{Amount: "10", Fee: 1}},
+	} {
+		e, err := r.decode("Paid", c.version, []byte(c.have))
+		if err != nil || e != c.want {
+			t.Fatalf("expected:%v got:%v %v", c.want, e, err)
+		}
+	}
+
+	// only current version is written
+	if _, _, _, err := r.encode(v2{}); !errors.Is(err, errCodecEvent) {
+		t.Fatalf("expected:%v got:%v", errCodecEvent, err)
+	}
+
+	if _, err := r.decode("Paid", 4, []byte(`{}`)); !errors.Is(err, errCodecEvent) {
+		t.Fatalf("expected:%v got:%v", errCodecEvent, err)
+	}
+}
+
+func TestEvents_Legacy(t *testing.T) {
+	m := newTestMoney(t, "10", "USD")
+	for _, c := range []struct {
+		name    string
+		version int
+		have    string
+		want    event
+	}{
+		{"TransactionReversed", 1, `{"Money":{"Amount":"10.00","Currency":"USD"}}`, domain.TransactionReversed{Exchange: domain.Exchange{Presentment: m}}},
+		{"TransactionRefunded", 1, `{"Money":{"Amount":"10.00","Currency":"USD"},"Refund":"a.r1","Capture":"a.c1"}`, domain.TransactionRefunded{Exchange: domain.Exchange{Presentment: m}, Refund: "a.r1", Capture: "a.c1"}},
+	} {
+		e, err := events.decode(c.name, c.version, []byte(c.have))
+		if err != nil || e != c.want {
+			t.Fatalf("expected:%v got:%v %v", c.want, e, err)
+		}
+	}
+}
+
+func TestPayload(t *testing.T) {
+	type case_ struct {
+		have payload
+		want string
+	}
+
+	for _, c := range []case_{
+		{payload(`{"Amount":"10"}`), `{"Amount":"10"}`},
+		{payload{gobMark, 1, 2}, `"AAEC"`},
+	} {
+		b, err := json.Marshal(c.have)
+		if err != nil || string(b) != c.want {
+			t.Fatalf("expected:%v got:%s %v", c.want, b, err)
+		}
+
+		var p payload
+		if err = json.Unmarshal(b, &p); err != nil || !bytes.Equal(p, c.have) {
+			t.Fatalf("expected:%v got:%v %v", c.have, p, err)
+		}
+	}
+}
+
+func TestNewFormat(t *testing.T) {
+	type case_ struct {
+		have string
+		want Format
+	}
+
+	for _, c := range []case_{
+		{"", JSON},
+		{"json", JSON},
+		{"gob", Gob},
+		{"binary", Gob},
+		{"xml", nil},
+	} {
+		if f, _ := NewFormat(c.have); f != c.want {
+			t.Fatalf("expected:%v got:%v", c.want, f)
+		}
+	}
+}
@@ -1,29 +1,75 @@
 package infra
 
 import (
-	"reflect"
+	"hash/fnv"
+	"sync"
 	"time"
+
+	"payment/domain"
 )
 
 type event = interface{}
 type message struct {
+	position  int64
 	stream    string
+	version   int
 	name      string
-	value     event
+	schema    int
+	data      []byte
 	createdAt time.Time
 }
 
 // Events - actual storage for all events from all Aggregate's
 //
 // Place where ACID is introduced.
-// No resilient implementation.
-// I would use Optimistic Concurrency Control algorithm in order to make every write ACID.
-// Additional in-memory cache is required in order to avoid loading all events from storage on every read.
-type Events map[string][]message
-
-func (r Events) read(a Aggregate) error {
-	for _, m := range r[a.ID()] {
-		if err := a.Commit(m.value, m.createdAt); err != nil {
+// No resilient implementation, events are kept encoded as durable stores keep them.
+// Optimistic Concurrency Control rejects write of Aggregate which stream was
+// changed since it was read, with domain.VersionConflictError.
+// Streams are spread over shards with own locks, so writes to different
+// Aggregates rarely wait for each other.
+// Snapshots avoid replaying all events of stream on every read.
+// Events of all streams are kept in order of global position as well.
+type Events struct {
+	shards [shards]shard
+	mu     sync.RWMutex
+	log    []message
+	signal signal
+}
+
+type shard struct {
+	mu      sync.RWMutex
+	streams map[string][]message
+}
+
+func NewEvents() *Events {
+	r := &Events{}
+	for i := range r.shards {
+		r.shards[i].streams = map[string][]message{}
+	}
+
+	return r
+}
+
+func (r *Events) read(a Aggregate) error {
+	s := r.shard(a.ID())
+	s.mu.RLock()
+	// messages are only appended, so read part of stream never changes
+	l := s.streams[a.ID()]
+	s.mu.RUnlock()
+
+	if v := a.Version(); v < len(l) {
+		l = l[v:]
+	} else {
+		l = nil
+	}
+
+	for _, m := range l {
+		v, err := events.decode(m.name, m.schema, m.data)
+		if err != nil {
+			return err
+		}
+
+		if err = a.Commit(v, m.createdAt); err != nil {
 			return err
 		}
 	}
@@ -31,32 +77,106 @@ func (r Events) read(a Aggregate) error {
 	return nil
 }
 
-func (r Events) write(a Aggregate) error {
+func (r *Events) write(a Aggregate) error {
 	n := time.Now()
-	s := a.ID()
-	for _, e := range a.Uncommitted(true) {
-		m := message{
-			stream:    s,
-			value:     e,
-			name:      reflect.TypeOf(e).Name(),
-			createdAt: time.Now(),
+	id := a.ID()
+	s := r.shard(id)
+
+	l := a.Uncommitted(false)
+	m := make([]message, len(l))
+	for i, e := range l {
+		name, v, b, err := events.encode(e)
+		if err != nil {
+			return err
 		}
-		r[s] = append(r[s], m)
 
+		m[i] = message{stream: id, version: a.Version() + i + 1, name: name, schema: v, data: b, createdAt: n}
+	}
+
+	s.mu.Lock()
+	if v := len(s.streams[id]); v != a.Version() {
+		s.mu.Unlock()
+		return domain.VersionConflictError{Stream: id, Expected: a.Version(), Actual: v}
+	}
+
+	// global log is appended under lock of shard, so events of stream keep order
+	r.mu.Lock()
+	for i := range m {
+		m[i].position = int64(len(r.log) + 1)
+		r.log = append(r.log, m[i])
+	}
+	r.mu.Unlock()
+
+	s.streams[id] = append(s.streams[id], m...)
+	s.mu.Unlock()
+	r.signal.notify()
+
+	for i, e := range a.Uncommitted(true) {
 		if err := a.Commit(e, n); err != nil {
 			return err
 		}
 
-		log("DBG #%s|%s", m.stream, m.name)
+		log("DBG #%s|%s", id, m[i].name)
 	}
 
 	return nil
 }
 
+func (r *Events) records(after int64, n int) ([]Record, error) {
+	r.mu.RLock()
+	l := r.log
+	r.mu.RUnlock()
+
+	if after >= int64(len(l)) {
+		return nil, nil
+	}
+
+	l = l[after:]
+	if len(l) > n {
+		l = l[:n]
+	}
+
+	c := make([]Record, len(l))
+	for i, m := range l {
+		e, err := events.decode(m.name, m.schema, m.data)
+		if err != nil {
+			return nil, err
+		}
+
+		c[i] = Record{m.position, m.stream, m.version, m.name, e, m.createdAt}
+	}
+
+	return c, nil
+}
+
+func (r *Events) changed() <-chan struct{} {
+	return r.signal.changed()
+}
+
+func (r *Events) shard(stream string) *shard {
+	h := fnv.New32a()
+	h.Write([]byte(stream))
+
+	return &r.shards[h.Sum32()%shards]
+}
+
+// Store keeps events of Aggregates, in memory (Events) or durable (Journal, SQL).
+// It is Feed of events of all Aggregates as well.
+type Store interface {
+	// read commits events of Aggregate newer than its Version.
+	read(Aggregate) error
+	write(Aggregate) error
+	Feed
+}
+
 type Aggregate interface {
 	ID() string
+	// Version is number of events committed to Aggregate.
+	Version() int
 	Uncommitted(bool) []event
 	Commit(event, time.Time) error
 }
 
+const shards = 64
+
 var log = DefaultLogger.Tag("EventStore").Print
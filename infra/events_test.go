@@ -0,0 +1,175 @@
+package infra
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"payment/app"
+	"payment/domain"
+)
+
+func TestEvents(t *testing.T) {
+	testStore(t, func(*testing.T) Store { return NewEvents() })
+}
+
+// testStore runs contract of Store on stores given by open.
+func testStore(t *testing.T, open func(*testing.T) Store) {
+	t.Run("conflict", func(t *testing.T) { testStoreConflict(t, open(t)) })
+	t.Run("concurrent", func(t *testing.T) { testStoreConcurrent(t, open(t)) })
+}
+
+func testStoreConflict(t *testing.T, s Store) {
+	r := NewTransactions(s)
+	id := newTestTransaction(t, r)
+
+	a, err := r.Read(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := r.Read(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, x := range []*domain.Transaction{a, b} {
+		if err = x.Void(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = r.Write(a); err != nil {
+		t.Fatal(err)
+	}
+
+	var c domain.VersionConflictError
+	if err = r.Write(b); !errors.As(err, &c) || c.Expected != 1 || c.Actual != 2 {
+		t.Fatalf("expected version conflict got:%v", err)
+	}
+}
+
+func testStoreConcurrent(t *testing.T, s Store) {
+	r := NewTransactions(s)
+	ids := make([]domain.ID, 8)
+	for i := range ids {
+		ids[i] = newTestTransaction(t, r)
+	}
+
+	m := newTestMoney(t, "10", "USD")
+
+	// 16 captures of 10USD race for every authorization of 100USD
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var captured = map[domain.ID]int{}
+	for _, id := range ids {
+		for i := 0; i < 16; i++ {
+			wg.Add(1)
+			go func(id domain.ID) {
+				defer wg.Done()
+				if err := capture(r, id, m); err == nil {
+					mu.Lock()
+					captured[id]++
+					mu.Unlock()
+				}
+			}(id)
+		}
+	}
+	wg.Wait()
+
+	for _, id := range ids {
+		a, err := r.Read(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if captured[id] != 10 || !a.Balance().IsZero() || len(a.Captures()) != 10 {
+			t.Fatalf("expected 10 captures of #%s got:%d %v", id, captured[id], a.Captures())
+		}
+	}
+}
+
+func BenchmarkEvents_Parallel(b *testing.B) {
+	defer func(l func(string, ...interface{})) { log = l }(log)
+	log = func(string, ...interface{}) {}
+
+	r := NewTransactions(NewEvents())
+	m := newTestMoney(b, "10", "USD")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			id := newTestTransaction(b, r)
+			if err := capture(r, id, m); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// capture m on Transaction of id, it is retried while other capture wins.
+func capture(r app.Transactions, id domain.ID, m domain.Money) error {
+	for {
+		a, err := r.Read(id)
+		if err != nil {
+			return err
+		}
+
+		if err = a.Capture(m, false, domain.HalfUp, approve); err != nil {
+			return err
+		}
+
+		if err = r.Write(a); !errors.As(err, new(domain.VersionConflictError)) {
+			return err
+		}
+	}
+}
+
+// newTestTransaction writes authorization of 100USD to r.
+func newTestTransaction(t testing.TB, r app.Transactions) domain.ID {
+	c, err := domain.NewCreditCard("Tom", "4000000000000044", "12/2099", "884")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := newTestMoney(t, "100", "USD")
+	rate, err := domain.NewRate("USD", "USD", "1", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	x, err := domain.NewExchange(m, rate, domain.HalfUp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := domain.NewID()
+	a, err := r.Read(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = a.Authorize(c, x, time.Now().Add(time.Hour), domain.Order{}, approve); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = r.Write(a); err != nil {
+		t.Fatal(err)
+	}
+
+	return id
+}
+
+func newTestMoney(t testing.TB, amount, currency string) domain.Money {
+	m, err := domain.NewMoney(amount, currency)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return m
+}
+
+// approve is Simulator without Scenarios, so it approves every request.
+var approve, _ = NewSimulator(1)
@@ -0,0 +1,71 @@
+package infra
+
+import (
+	"sync"
+	"time"
+
+	"payment/app"
+	"payment/domain"
+)
+
+// Idempotency keeps app.Results in memory until their TTL passes.
+type Idempotency struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	results map[string]result
+}
+
+func NewIdempotency(ttl time.Duration) *Idempotency {
+	return &Idempotency{ttl: ttl, results: map[string]result{}}
+}
+
+func (i *Idempotency) Reserve(key, hash string) (app.Result, bool, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	now := time.Now()
+	i.expire(now)
+
+	if r, ok := i.results[key]; ok {
+		return r.Result, true, nil
+	}
+
+	i.results[key] = result{app.Result{Hash: hash}, now}
+	return app.Result{}, false, nil
+}
+
+func (i *Idempotency) Save(key string, r app.Result) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	x, ok := i.results[key]
+	if !ok || x.Hash != r.Hash {
+		return errIdempotencyKey
+	}
+
+	i.results[key] = result{r, x.at}
+	return nil
+}
+
+func (i *Idempotency) Release(key string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	delete(i.results, key)
+	return nil
+}
+
+func (i *Idempotency) expire(now time.Time) {
+	for k, r := range i.results {
+		if now.Sub(r.at) >= i.ttl {
+			delete(i.results, k)
+		}
+	}
+}
+
+type result struct {
+	app.Result
+	at time.Time
+}
+
+var errIdempotencyKey = domain.Err("idempotency: key not reserved")
@@ -0,0 +1,45 @@
+package infra
+
+import (
+	"testing"
+	"time"
+
+	"payment/app"
+)
+
+func TestIdempotency(t *testing.T) {
+	i := NewIdempotency(time.Hour)
+	if _, ok, err := i.Reserve("k", "a"); ok || err != nil {
+		t.Fatalf("expected reservation got:%v %v", ok, err)
+	}
+
+	if r, ok, err := i.Reserve("k", "a"); !ok || err != nil || r.Status != 0 {
+		t.Fatalf("expected request in progress got:%v %v %v", r, ok, err)
+	}
+
+	w := app.Result{Hash: "a", Status: 200, Body: []byte(`{}`)}
+	if err := i.Save("k", w); err != nil {
+		t.Fatal(err)
+	}
+
+	if r, ok, err := i.Reserve("k", "b"); !ok || err != nil || r.Hash != "a" || r.Status != 200 {
+		t.Fatalf("expected:%v got:%v %v %v", w, r, ok, err)
+	}
+
+	if err := i.Save("x", w); err != errIdempotencyKey {
+		t.Fatalf("expected:%v got:%v", errIdempotencyKey, err)
+	}
+
+	if err := i.Release("k"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok, _ := i.Reserve("k", "b"); ok {
+		t.Fatal("expected released key to be reserved again")
+	}
+
+	i.ttl = 0
+	if _, ok, _ := i.Reserve("k", "b"); ok {
+		t.Fatal("expected expired key to be reserved again")
+	}
+}
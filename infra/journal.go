@@ -0,0 +1,519 @@
+package infra
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"payment/domain"
+)
+
+// Journal is durable Store of Aggregate's events, an append-only log split
+// into segment files of directory.
+//
+// Every write of Aggregate is a single entry, so its events are stored all or
+// none: 4 bytes of payload length, 4 bytes of payload CRC-32C and JSON payload.
+// Torn record at the end of last segment, left by crash, is truncated on open.
+// Offsets of records of every stream are indexed in memory, index is rebuilt
+// from segments on open. Events are numbered by global position in order of
+// records, so Journal is Feed of Subscriptions.
+type Journal struct {
+	mu       sync.RWMutex
+	dir      string
+	fsync    Fsync
+	limit    int64
+	segments []*segment
+	index    map[string][]position
+	versions map[string]int
+	log      []position
+	total    int64
+	signal   signal
+	dirty    bool
+	done     chan struct{}
+}
+
+type segment struct {
+	file *os.File
+	size int64
+}
+
+// position of record in segment, version is one of stream before record and
+// global is position of its first event in Journal.
+type position struct {
+	segment int
+	offset  int64
+	length  int64
+	version int
+	global  int64
+	events  int
+}
+
+// OpenJournal of dir, segments are rolled when they exceed limit of bytes,
+// default one is used when limit is zero.
+func OpenJournal(dir string, f Fsync, limit int64) (*Journal, error) {
+	if limit <= 0 {
+		limit = segmentLimit
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	l, err := filepath.Glob(filepath.Join(dir, "*.log"))
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(l)
+	j := &Journal{
+		dir:      dir,
+		fsync:    f,
+		limit:    limit,
+		index:    map[string][]position{},
+		versions: map[string]int{},
+		done:     make(chan struct{}),
+	}
+
+	for i, n := range l {
+		if n != j.name(i) {
+			j.Close()
+			return nil, domain.Err("%w, unexpected segment %s", errJournalCorrupted, n)
+		}
+
+		f, err := os.OpenFile(n, os.O_RDWR, 0600)
+		if err != nil {
+			j.Close()
+			return nil, err
+		}
+
+		j.segments = append(j.segments, &segment{file: f})
+		if err = j.recover(i, i == len(l)-1); err != nil {
+			j.Close()
+			return nil, err
+		}
+	}
+
+	if len(j.segments) == 0 {
+		if err = j.roll(); err != nil {
+			j.Close()
+			return nil, err
+		}
+	}
+
+	if f > 0 {
+		go j.flush()
+	}
+
+	return j, nil
+}
+
+// Close flushes and closes segments.
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	select {
+	case <-j.done:
+		return nil
+	default:
+		close(j.done)
+	}
+
+	var err error
+	for _, s := range j.segments {
+		if x := s.file.Sync(); x != nil && err == nil {
+			err = x
+		}
+
+		if x := s.file.Close(); x != nil && err == nil {
+			err = x
+		}
+	}
+
+	return err
+}
+
+func (j *Journal) read(a Aggregate) error {
+	j.mu.RLock()
+	l := append([]position(nil), j.index[a.ID()]...)
+	s := j.segments
+	j.mu.RUnlock()
+
+	// records with events newer than version of Aggregate only
+	v := a.Version()
+	i := sort.Search(len(l), func(i int) bool { return l[i].version > v })
+	if i > 0 {
+		i--
+	}
+
+	for _, p := range l[i:] {
+		r, err := j.entry(s, p)
+		if err != nil {
+			return err
+		}
+
+		for k, e := range r.Events {
+			if r.Version+k < a.Version() {
+				continue
+			}
+
+			v, err := events.decode(e.Name, e.Version, e.Data)
+			if err != nil {
+				return err
+			}
+
+			if err = a.Commit(v, r.CreatedAt); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (j *Journal) write(a Aggregate) error {
+	n := time.Now()
+	id := a.ID()
+	l := a.Uncommitted(false)
+	if len(l) == 0 {
+		return nil
+	}
+
+	r := entry{Stream: id, Version: a.Version(), CreatedAt: n}
+	for _, e := range l {
+		name, v, b, err := events.encode(e)
+		if err != nil {
+			return err
+		}
+
+		r.Events = append(r.Events, entryEvent{name, v, b})
+	}
+
+	b, err := r.encode()
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	if v := j.versions[id]; v != a.Version() {
+		j.mu.Unlock()
+		return domain.VersionConflictError{Stream: id, Expected: a.Version(), Actual: v}
+	}
+
+	if err = j.append(id, b, len(l)); err != nil {
+		j.mu.Unlock()
+		return err
+	}
+	j.mu.Unlock()
+	j.signal.notify()
+
+	for i, e := range a.Uncommitted(true) {
+		if err = a.Commit(e, n); err != nil {
+			return err
+		}
+
+		log("DBG #%s|%s", id, r.Events[i].Name)
+	}
+
+	return nil
+}
+
+// append record of stream with n events, it has to be called under lock.
+func (j *Journal) append(stream string, b []byte, n int) error {
+	s := j.segments[len(j.segments)-1]
+	if s.size > 0 && s.size+int64(len(b)) > j.limit {
+		if err := j.roll(); err != nil {
+			return err
+		}
+
+		s = j.segments[len(j.segments)-1]
+	}
+
+	if _, err := s.file.WriteAt(b, s.size); err != nil {
+		s.file.Truncate(s.size)
+		return err
+	}
+
+	if j.fsync == FsyncAlways {
+		if err := s.file.Sync(); err != nil {
+			s.file.Truncate(s.size)
+			return err
+		}
+	}
+
+	j.dirty = j.fsync != FsyncAlways
+	j.track(stream, position{len(j.segments) - 1, s.size, int64(len(b)), j.versions[stream], j.total + 1, n})
+	s.size += int64(len(b))
+
+	return nil
+}
+
+// track record at p of stream in indexes, it has to be called under lock.
+func (j *Journal) track(stream string, p position) {
+	j.index[stream] = append(j.index[stream], p)
+	j.versions[stream] += p.events
+	j.log = append(j.log, p)
+	j.total += int64(p.events)
+}
+
+// records of all streams after global position, at most n of them.
+func (j *Journal) records(after int64, n int) ([]Record, error) {
+	j.mu.RLock()
+	l := j.log
+	s := j.segments
+	j.mu.RUnlock()
+
+	// record holding event after position and ones following it
+	i := sort.Search(len(l), func(i int) bool { return l[i].global+int64(l[i].events) > after+1 })
+	var x []Record
+	for _, p := range l[i:] {
+		if len(x) >= n {
+			break
+		}
+
+		r, err := j.entry(s, p)
+		if err != nil {
+			return nil, err
+		}
+
+		for k, e := range r.Events {
+			g := p.global + int64(k)
+			if g <= after || len(x) >= n {
+				continue
+			}
+
+			v, err := events.decode(e.Name, e.Version, e.Data)
+			if err != nil {
+				return nil, err
+			}
+
+			x = append(x, Record{g, r.Stream, r.Version + k + 1, e.Name, v, r.CreatedAt})
+		}
+	}
+
+	return x, nil
+}
+
+func (j *Journal) changed() <-chan struct{} {
+	return j.signal.changed()
+}
+
+// entry of record at p of segments s.
+func (j *Journal) entry(s []*segment, p position) (entry, error) {
+	b := make([]byte, p.length)
+	if _, err := s[p.segment].file.ReadAt(b, p.offset); err != nil {
+		return entry{}, err
+	}
+
+	r, _, err := readEntry(bytes.NewReader(b))
+	if err != nil {
+		return entry{}, domain.Err("%w at %d of %s", err, p.offset, j.name(p.segment))
+	}
+
+	return r, nil
+}
+
+// recover index from records of i-th segment, torn record of last segment is
+// truncated, anywhere else it means corruption.
+func (j *Journal) recover(i int, last bool) error {
+	s := j.segments[i]
+	b := bufio.NewReader(io.NewSectionReader(s.file, 0, 1<<62))
+
+	var o int64
+	for {
+		r, n, err := readEntry(b)
+		if err == io.EOF {
+			break
+		}
+
+		if err == nil && r.Version != j.versions[r.Stream] {
+			err = domain.Err("%w, #%s version %d expected %d", errJournalCorrupted, r.Stream, r.Version, j.versions[r.Stream])
+		}
+
+		if err != nil && !last {
+			return domain.Err("%w at %d of %s", err, o, j.name(i))
+		}
+
+		if err != nil {
+			log("ERR torn record at %d of %s truncated due %s", o, j.name(i), err)
+			if err = s.file.Truncate(o); err != nil {
+				return err
+			}
+
+			break
+		}
+
+		j.track(r.Stream, position{i, o, n, r.Version, j.total + 1, len(r.Events)})
+		o += n
+	}
+
+	s.size = o
+	return nil
+}
+
+// roll new segment, previous one is flushed unless FsyncNever.
+func (j *Journal) roll() error {
+	if l := len(j.segments); l != 0 && j.fsync != FsyncNever {
+		if err := j.segments[l-1].file.Sync(); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(j.name(len(j.segments)), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+
+	j.segments = append(j.segments, &segment{file: f})
+	return syncDir(j.dir)
+}
+
+func (j *Journal) flush() {
+	t := time.NewTicker(time.Duration(j.fsync))
+	defer t.Stop()
+
+	for {
+		select {
+		case <-j.done:
+			return
+		case <-t.C:
+			if err := j.sync(); err != nil {
+				log("ERR journal flush failed due %s", err)
+			}
+		}
+	}
+}
+
+func (j *Journal) sync() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if !j.dirty {
+		return nil
+	}
+
+	j.dirty = false
+	return j.segments[len(j.segments)-1].file.Sync()
+}
+
+func (j *Journal) name(i int) string {
+	return filepath.Join(j.dir, fmt.Sprintf("%020d.log", i))
+}
+
+// Fsync tells when Journal flushes written records to disk: after every write
+// (FsyncAlways), never leaving it to operating system (FsyncNever), or
+// periodically with given interval.
+type Fsync time.Duration
+
+const (
+	FsyncAlways Fsync = 0
+	FsyncNever  Fsync = -1
+)
+
+// NewFsync parses always, never or interval, ie 100ms.
+func NewFsync(s string) (Fsync, error) {
+	switch s {
+	case "", "always":
+		return FsyncAlways, nil
+	case "never":
+		return FsyncNever, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, errJournalFsync
+	}
+
+	return Fsync(d), nil
+}
+
+// entry is payload of Journal record, Version is version of stream before its
+// Events were written.
+type entry struct {
+	Stream    string
+	Version   int
+	Events    []entryEvent
+	CreatedAt time.Time
+}
+
+type entryEvent struct {
+	Name    string
+	Version int `json:",omitempty"`
+	Data    payload
+}
+
+func (r entry) encode() ([]byte, error) {
+	p, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, header+len(p))
+	binary.BigEndian.PutUint32(b[0:4], uint32(len(p)))
+	binary.BigEndian.PutUint32(b[4:8], crc32.Checksum(p, crc))
+	copy(b[header:], p)
+
+	return b, nil
+}
+
+// readEntry gives entry and length of its record with header, io.EOF is returned only
+// when nothing was read.
+func readEntry(r io.Reader) (entry, int64, error) {
+	var h [header]byte
+	if _, err := io.ReadFull(r, h[:]); err != nil {
+		return entry{}, 0, err
+	}
+
+	n := binary.BigEndian.Uint32(h[0:4])
+	if n == 0 || n > entryLimit {
+		return entry{}, 0, domain.Err("%w, invalid entry length %d", errJournalCorrupted, n)
+	}
+
+	p := make([]byte, n)
+	if _, err := io.ReadFull(r, p); err != nil {
+		return entry{}, 0, io.ErrUnexpectedEOF
+	}
+
+	if crc32.Checksum(p, crc) != binary.BigEndian.Uint32(h[4:8]) {
+		return entry{}, 0, domain.Err("%w, invalid checksum", errJournalCorrupted)
+	}
+
+	var x entry
+	if err := json.Unmarshal(p, &x); err != nil {
+		return entry{}, 0, domain.Err("%w, %s", errJournalCorrupted, err)
+	}
+
+	return x, int64(header + n), nil
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
+
+const (
+	header       = 8
+	segmentLimit = 64 << 20
+	entryLimit   = 16 << 20
+)
+
+var crc = crc32.MakeTable(crc32.Castagnoli)
+
+var (
+	errJournalCorrupted = domain.Err("journal: corrupted")
+	errJournalFsync     = domain.Err("journal: invalid fsync, expected always, never or interval ie 100ms")
+)
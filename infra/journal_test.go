@@ -0,0 +1,168 @@
+package infra
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"payment/domain"
+)
+
+func TestJournal(t *testing.T) {
+	testStore(t, func(t *testing.T) Store {
+		j, err := OpenJournal(t.TempDir(), FsyncNever, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		t.Cleanup(func() { j.Close() })
+		return j
+	})
+}
+
+func TestJournal_Reopen(t *testing.T) {
+	d := t.TempDir()
+	j, err := OpenJournal(d, FsyncAlways, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewTransactions(j)
+	m := newTestMoney(t, "10", "USD")
+	ids := make(map[string]bool)
+	for i := 0; i < 8; i++ {
+		id := newTestTransaction(t, r)
+		if err = capture(r, id, m); err != nil {
+			t.Fatal(err)
+		}
+
+		ids[string(id)] = true
+	}
+
+	if l, _ := filepath.Glob(filepath.Join(d, "*.log")); len(l) < 2 {
+		t.Fatalf("expected rolled segments got:%v", l)
+	}
+
+	if err = j.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if j, err = OpenJournal(d, FsyncAlways, 1024); err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	r = NewTransactions(j)
+	for id := range ids {
+		a, err := r.Read(domain.ID(id))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if a.Version() != 2 || a.Captured() != m || a.Status() != domain.PartiallyCaptured {
+			t.Fatalf("expected captured %v of #%s got:%v %v", m, id, a.Captured(), a.Version())
+		}
+	}
+}
+
+func TestJournal_Recover(t *testing.T) {
+	type (
+		have []byte
+
+		case_ struct {
+			description string
+			have
+		}
+	)
+
+	scenario := []case_{
+		{"torn header gives truncation", have{0, 0, 1}},
+		{"torn payload gives truncation", have{0, 0, 0, 10, 0, 0, 0, 0, '{'}},
+		{"invalid checksum gives truncation", have{0, 0, 0, 2, 0, 0, 0, 0, '{', '}'}},
+	}
+
+	for _, c := range scenario {
+		t.Run(c.description, func(t *testing.T) {
+			d := t.TempDir()
+			j, err := OpenJournal(d, FsyncAlways, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			id := newTestTransaction(t, NewTransactions(j))
+			j.Close()
+
+			n := filepath.Join(d, "00000000000000000000.log")
+			i, err := os.Stat(n)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			f, err := os.OpenFile(n, os.O_APPEND|os.O_WRONLY, 0600)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			f.Write(c.have)
+			f.Close()
+
+			if j, err = OpenJournal(d, FsyncAlways, 0); err != nil {
+				t.Fatal(err)
+			}
+			defer j.Close()
+
+			if x, _ := os.Stat(n); x.Size() != i.Size() {
+				t.Fatalf("expected size:%d got:%d", i.Size(), x.Size())
+			}
+
+			r := NewTransactions(j)
+			if err = capture(r, id, newTestMoney(t, "10", "USD")); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestJournal_Corrupted(t *testing.T) {
+	d := t.TempDir()
+	j, err := OpenJournal(d, FsyncAlways, 512)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewTransactions(j)
+	for i := 0; i < 4; i++ {
+		newTestTransaction(t, r)
+	}
+	j.Close()
+
+	// corruption of sealed segment is not a torn write
+	n := filepath.Join(d, "00000000000000000000.log")
+	b, err := os.ReadFile(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b[len(b)-2] ^= 0xff
+	if err = os.WriteFile(n, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = OpenJournal(d, FsyncAlways, 512); !errors.Is(err, errJournalCorrupted) {
+		t.Fatalf("expected:%v got:%v", errJournalCorrupted, err)
+	}
+}
+
+func TestNewFsync(t *testing.T) {
+	for s, want := range map[string]Fsync{"always": FsyncAlways, "never": FsyncNever, "100ms": Fsync(100 * time.Millisecond)} {
+		if f, err := NewFsync(s); err != nil || f != want {
+			t.Fatalf("expected:%v got:%v %v", want, f, err)
+		}
+	}
+
+	if _, err := NewFsync("-1s"); err != errJournalFsync {
+		t.Fatalf("expected:%v got:%v", errJournalFsync, err)
+	}
+}
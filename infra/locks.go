@@ -0,0 +1,47 @@
+package infra
+
+import (
+	"sync"
+
+	"payment/domain"
+)
+
+// Locks serialize commands of Transaction within process, locks of
+// Transactions without waiting commands are dropped.
+type Locks struct {
+	mu    sync.Mutex
+	locks map[domain.ID]*lock
+}
+
+type lock struct {
+	sync.Mutex
+	waiting int
+}
+
+func NewLocks() *Locks {
+	return &Locks{locks: map[domain.ID]*lock{}}
+}
+
+func (l *Locks) Lock(id domain.ID) (func(), error) {
+	l.mu.Lock()
+	x, ok := l.locks[id]
+	if !ok {
+		x = &lock{}
+		l.locks[id] = x
+	}
+
+	x.waiting++
+	l.mu.Unlock()
+
+	x.Lock()
+	return func() {
+		x.Unlock()
+
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		if x.waiting--; x.waiting == 0 {
+			delete(l.locks, id)
+		}
+	}, nil
+}
@@ -0,0 +1,191 @@
+package infra
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"payment/app"
+	"payment/domain"
+)
+
+func TestLocks(t *testing.T) {
+	for _, c := range []struct {
+		case_ string
+		open  func(*testing.T) app.Locks
+	}{
+		{"memory", func(*testing.T) app.Locks { return NewLocks() }},
+		{"sql", func(t *testing.T) app.Locks {
+			s, err := OpenSQL("sqlite3", newTestSQLite(t))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			t.Cleanup(func() { s.Close() })
+			return s
+		}},
+	} {
+		t.Run(c.case_, func(t *testing.T) {
+			l := c.open(t)
+
+			// only one command of Transaction at a time
+			var wg sync.WaitGroup
+			var mu sync.Mutex
+			var inside, overlaps int
+			for i := 0; i < 8; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					unlock, err := l.Lock("a")
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					defer unlock()
+
+					mu.Lock()
+					if inside++; inside > 1 {
+						overlaps++
+					}
+					mu.Unlock()
+
+					time.Sleep(time.Millisecond)
+
+					mu.Lock()
+					inside--
+					mu.Unlock()
+				}()
+			}
+
+			// other Transactions are not blocked
+			unlock, err := l.Lock("b")
+			if err != nil {
+				t.Fatal(err)
+			}
+			unlock()
+
+			wg.Wait()
+			if overlaps != 0 {
+				t.Fatalf("expected:0 got:%v", overlaps)
+			}
+		})
+	}
+}
+
+func TestSQL_Lock(t *testing.T) {
+	s, err := OpenSQL("sqlite3", newTestSQLite(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// lock left by crashed process is taken over when lease expires
+	n := time.Now().UTC()
+	for _, x := range []struct {
+		stream    string
+		expiresAt time.Time
+	}{
+		{"expired", n.Add(-time.Second)},
+		{"held", n.Add(time.Hour)},
+	} {
+		if _, err = s.db.Exec(`INSERT INTO locks (stream, owner, expires_at) VALUES (?, ?, ?)`, x.stream, "crashed", x.expiresAt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	unlock, err := s.Lock("expired")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+
+	defer func(d time.Duration) { lease = d }(lease)
+	lease = 50 * time.Millisecond
+
+	if _, err = s.Lock("held"); err != errSQLLocked {
+		t.Fatalf("expected:%v got:%v", errSQLLocked, err)
+	}
+}
+
+func TestPayment_Concurrent(t *testing.T) {
+	p, err := NewSimulator(1, Scenario{Operation: "capture", Delay: Duration(10 * time.Millisecond)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewSchedule("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := NewReferences("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &countingProcessor{Simulator: p}
+	r := app.Resources{
+		Transactions: NewTransactions(NewEvents()),
+		Rates:        NewRates(),
+		Processor:    c,
+		Schedule:     s,
+		References:   f,
+		Locks:        NewLocks(),
+	}
+
+	card, err := domain.NewCreditCard("Tom", "4000000000000044", "12/2099", "884")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := domain.NewID()
+	if _, err = app.NewPayment(id, testMerchant{}, r).Authorize(card, newTestMoney(t, "100", "USD"), "", domain.Order{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// two captures of 60USD race for authorization of 100USD
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			app.NewPayment(id, testMerchant{}, r).Capture(newTestMoney(t, "60", "USD"), false)
+		}()
+	}
+	wg.Wait()
+
+	a, err := r.Transactions.Read(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.captured != a.Captured().Minor() {
+		t.Fatalf("expected:%v got:%v", a.Captured().Minor(), c.captured)
+	}
+}
+
+// countingProcessor keeps total of captures in minor units sent to card network.
+type countingProcessor struct {
+	*Simulator
+	mu       sync.Mutex
+	captured int64
+}
+
+func (p *countingProcessor) Capture(c domain.Card, m domain.Money) error {
+	if err := p.Simulator.Capture(c, m); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.captured += m.Minor()
+	return nil
+}
+
+type testMerchant struct{}
+
+func (testMerchant) ID() string                                  { return "test" }
+func (testMerchant) IsAuthenticated() bool                       { return true }
+func (testMerchant) Accepts(domain.Brand) bool                   { return true }
+func (testMerchant) AuthorizationTTL(domain.Brand) time.Duration { return 0 }
@@ -0,0 +1,71 @@
+package infra
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"payment/domain"
+)
+
+// Rates keeps history of timestamped foreign exchange rates in memory, it can
+// be loaded from JSON file with list of {"From", "To", "Rate", "At"} objects.
+type Rates struct {
+	mu    sync.RWMutex
+	pairs map[string][]domain.Rate
+}
+
+func NewRates(r ...domain.Rate) *Rates {
+	x := &Rates{pairs: make(map[string][]domain.Rate)}
+	x.Add(r...)
+
+	return x
+}
+
+func ReadRates(path string) (*Rates, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var r []domain.Rate
+	if err = json.Unmarshal(b, &r); err != nil {
+		return nil, err
+	}
+
+	return NewRates(r...), nil
+}
+
+func (r *Rates) Add(rates ...domain.Rate) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, x := range rates {
+		p := x.From() + x.To()
+		r.pairs[p] = append(r.pairs[p], x)
+		sort.SliceStable(r.pairs[p], func(i, j int) bool { return r.pairs[p][i].At().Before(r.pairs[p][j].At()) })
+	}
+}
+
+// Rate gives latest Rate of currency pair published not later than at, Rate
+// of same currencies is always 1.
+func (r *Rates) Rate(from, to string, at time.Time) (domain.Rate, error) {
+	if from == to {
+		return domain.NewRate(from, to, "1", at)
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	h := r.pairs[from+to]
+	n := sort.Search(len(h), func(i int) bool { return h[i].At().After(at) })
+	if n == 0 {
+		return domain.Rate{}, domain.Err("%w %s/%s at %s", errRateNotFound, from, to, at.Format(time.RFC3339))
+	}
+
+	return h[n-1], nil
+}
+
+var errRateNotFound = domain.NewError(domain.NotFound, "rate_not_found", "exchange: rate not found")
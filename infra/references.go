@@ -0,0 +1,123 @@
+package infra
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"sync"
+
+	"payment/domain"
+)
+
+// References keeps merchant references of orders in memory and, when path is
+// given, in JSON file which is replaced atomically on every change, as
+// Schedule does.
+type References struct {
+	mu   sync.Mutex
+	path string
+	ids  map[reference]domain.ID
+}
+
+func NewReferences(path string) (*References, error) {
+	r := &References{path: path, ids: map[reference]domain.ID{}}
+	if path == "" {
+		return r, nil
+	}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return r, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var l []jsonReference
+	if err = json.Unmarshal(b, &l); err != nil {
+		return nil, err
+	}
+
+	for _, x := range l {
+		r.ids[reference{x.Merchant, x.Reference}] = x.ID
+	}
+
+	return r, nil
+}
+
+func (r *References) Reserve(merchant, ref string, id domain.ID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	k := reference{merchant, ref}
+	if _, ok := r.ids[k]; ok {
+		return errReferenceTaken
+	}
+
+	r.ids[k] = id
+	if err := r.save(); err != nil {
+		delete(r.ids, k)
+		return err
+	}
+
+	return nil
+}
+
+func (r *References) Release(merchant, ref string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	k := reference{merchant, ref}
+	id, ok := r.ids[k]
+	if !ok {
+		return nil
+	}
+
+	delete(r.ids, k)
+	if err := r.save(); err != nil {
+		r.ids[k] = id
+		return err
+	}
+
+	return nil
+}
+
+func (r *References) Find(merchant, ref string) (domain.ID, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id, ok := r.ids[reference{merchant, ref}]
+	if !ok {
+		return "", errReferenceNotFound
+	}
+
+	return id, nil
+}
+
+func (r *References) save() error {
+	if r.path == "" {
+		return nil
+	}
+
+	l := make([]jsonReference, 0, len(r.ids))
+	for k, id := range r.ids {
+		l = append(l, jsonReference{k.merchant, k.reference, id})
+	}
+
+	return replaceJSON(r.path, l)
+}
+
+type reference struct {
+	merchant, reference string
+}
+
+type jsonReference struct {
+	Merchant, Reference string
+	ID                  domain.ID
+}
+
+var (
+	errReferenceTaken    = domain.NewError(domain.Conflict, "merchant_reference_taken", "references: merchant reference already used")
+	errReferenceNotFound = domain.NewError(domain.NotFound, "merchant_reference_not_found", "references: merchant reference not found")
+)
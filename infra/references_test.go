@@ -0,0 +1,90 @@
+package infra
+
+import (
+	"path/filepath"
+	"testing"
+
+	"payment/app"
+)
+
+func TestReferences(t *testing.T) {
+	for _, c := range []struct {
+		case_ string
+		open  func(*testing.T) func() app.References
+	}{
+		{"file", func(t *testing.T) func() app.References {
+			p := filepath.Join(t.TempDir(), "references.json")
+			return func() app.References {
+				r, err := NewReferences(p)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				return r
+			}
+		}},
+		{"sql", func(t *testing.T) func() app.References {
+			d := newTestSQLite(t)
+			return func() app.References {
+				s, err := OpenSQL("sqlite3", d)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				t.Cleanup(func() { s.Close() })
+				return s
+			}
+		}},
+	} {
+		t.Run(c.case_, func(t *testing.T) {
+			open := c.open(t)
+			r := open()
+			if err := r.Reserve("m", "order-1", "a"); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := r.Reserve("m", "order-1", "b"); err != errReferenceTaken {
+				t.Fatalf("expected:%v got:%v", errReferenceTaken, err)
+			}
+
+			if err := r.Reserve("n", "order-1", "b"); err != nil {
+				t.Fatalf("expected reference of another merchant got:%v", err)
+			}
+
+			if err := r.Reserve("m", "order-2", "c"); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := r.Release("m", "order-2"); err != nil {
+				t.Fatal(err)
+			}
+
+			// restart
+			r = open()
+			for _, x := range []struct {
+				merchant, ref string
+				want          error
+			}{
+				{"m", "order-1", nil},
+				{"n", "order-1", nil},
+				{"m", "order-2", errReferenceNotFound},
+			} {
+				if _, err := r.Find(x.merchant, x.ref); err != x.want {
+					t.Fatalf("%s expected:%v got:%v", x.ref, x.want, err)
+				}
+			}
+
+			if id, err := r.Find("m", "order-1"); err != nil || id != "a" {
+				t.Fatalf("expected:a got:%v %v", id, err)
+			}
+
+			if err := r.Release("m", "order-1"); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := r.Find("m", "order-1"); err != errReferenceNotFound {
+				t.Fatalf("expected:%v got:%v", errReferenceNotFound, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package infra
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"payment/domain"
+)
+
+// Schedule keeps due moments of transactions in memory and, when path is
+// given, in JSON file which is replaced atomically on every change, so it is
+// restored after restart.
+type Schedule struct {
+	mu   sync.Mutex
+	path string
+	due  map[domain.ID]time.Time
+}
+
+func NewSchedule(path string) (*Schedule, error) {
+	s := &Schedule{path: path, due: make(map[domain.ID]time.Time)}
+	if path == "" {
+		return s, nil
+	}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return s, json.Unmarshal(b, &s.due)
+}
+
+func (s *Schedule) Add(id domain.ID, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.due[id] = at
+	return s.save()
+}
+
+// Due gives transactions which are due before given moment, earliest first.
+func (s *Schedule) Due(at time.Time) ([]domain.ID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var l []domain.ID
+	for id, t := range s.due {
+		if !t.After(at) {
+			l = append(l, id)
+		}
+	}
+
+	sort.Slice(l, func(i, j int) bool { return s.due[l[i]].Before(s.due[l[j]]) })
+	return l, nil
+}
+
+func (s *Schedule) Remove(id domain.ID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.due[id]; !ok {
+		return nil
+	}
+
+	delete(s.due, id)
+	return s.save()
+}
+
+func (s *Schedule) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	return replaceJSON(s.path, s.due)
+}
+
+// replaceJSON file at path with v atomically, it is written aside and renamed.
+func replaceJSON(path string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	t := path + ".tmp"
+	if err = os.WriteFile(t, b, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(t, path)
+}
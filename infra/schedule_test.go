@@ -0,0 +1,72 @@
+package infra
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"payment/app"
+	"payment/domain"
+)
+
+func TestSchedule(t *testing.T) {
+	for _, c := range []struct {
+		case_ string
+		open  func(*testing.T) func() app.Schedule
+	}{
+		{"file", func(t *testing.T) func() app.Schedule {
+			p := filepath.Join(t.TempDir(), "schedule.json")
+			return func() app.Schedule {
+				s, err := NewSchedule(p)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				return s
+			}
+		}},
+		{"sql", func(t *testing.T) func() app.Schedule {
+			d := newTestSQLite(t)
+			return func() app.Schedule {
+				s, err := OpenSQL("sqlite3", d)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				t.Cleanup(func() { s.Close() })
+				return s
+			}
+		}},
+	} {
+		t.Run(c.case_, func(t *testing.T) {
+			open := c.open(t)
+			s := open()
+			n := time.Now()
+			for id, at := range map[domain.ID]time.Time{"a": n.Add(time.Hour), "b": n.Add(-time.Hour), "c": n.Add(-time.Minute), "d": n.Add(3 * time.Hour)} {
+				if err := s.Add(id, at); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := s.Remove("c"); err != nil {
+				t.Fatal(err)
+			}
+
+			// moved earlier, added again
+			if err := s.Add("d", n.Add(-2*time.Hour)); err != nil {
+				t.Fatal(err)
+			}
+
+			// restart
+			s = open()
+			l, err := s.Due(n.Add(2 * time.Hour))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(l) != 3 || l[0] != "d" || l[1] != "b" || l[2] != "a" {
+				t.Fatalf("expected:[d b a] got:%v", l)
+			}
+		})
+	}
+}
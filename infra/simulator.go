@@ -0,0 +1,202 @@
+package infra
+
+import (
+	"encoding/json"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"payment/domain"
+)
+
+// Simulator is card network Processor which responds according to Scenarios,
+// every request not matched by any Scenario is approved.
+//
+// Scenarios are checked in order, first matching one decides about response.
+type Simulator struct {
+	mu        sync.Mutex
+	random    *rand.Rand
+	scenarios []Scenario
+}
+
+// Scenario of card network response, empty criteria match everything.
+//
+// Operation is one of authorize, verify, increment, reverse, capture or refund. PAN matches card number.
+// Amount matches exact Money, Above matches Money greater than given and Cents
+// matches trailing digits of amount in minor units, ie "13" matches 10.13 USD.
+// Probability tells how often matched Scenario applies, always when zero.
+//
+// Decline is issuer response code returned after Delay, Timeout responds with
+// 68 (response received too late) after Delay. CVV and AVS are results of
+// verify, they match when not given and card data is present.
+type Scenario struct {
+	Operation   string
+	PAN         string
+	Amount      domain.Money
+	Above       domain.Money
+	Cents       string
+	Probability float64
+	Decline     string
+	Delay       Duration
+	Timeout     bool
+	CVV         domain.Check
+	AVS         domain.Check
+
+	fingerprint string
+}
+
+func NewSimulator(seed int64, s ...Scenario) (*Simulator, error) {
+	s = append([]Scenario(nil), s...)
+	for i := range s {
+		if s[i].PAN == "" {
+			continue
+		}
+
+		f, err := domain.Fingerprint(s[i].PAN)
+		if err != nil {
+			return nil, err
+		}
+
+		s[i].fingerprint = f
+	}
+
+	return &Simulator{random: rand.New(rand.NewSource(seed)), scenarios: s}, nil
+}
+
+// ReadSimulator loads {"Seed": 1, "Scenarios": [...]} JSON file.
+func ReadSimulator(path string) (*Simulator, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var j struct {
+		Seed      int64
+		Scenarios []Scenario
+	}
+
+	if err = json.Unmarshal(b, &j); err != nil {
+		return nil, err
+	}
+
+	return NewSimulator(j.Seed, j.Scenarios...)
+}
+
+func (s *Simulator) Authorize(c domain.CreditCard, m domain.Money) error {
+	return s.respond("authorize", c.Card(), m)
+}
+
+func (s *Simulator) Verify(c domain.CreditCard, m domain.Money, d domain.Address) (domain.Verification, error) {
+	v := domain.Verification{CVV: domain.Unchecked, AVS: domain.Unchecked}
+	if c.HasCVV() {
+		v.CVV = domain.Matched
+	}
+
+	if !d.IsZero() {
+		v.AVS = domain.Matched
+	}
+
+	x, ok := s.match("verify", c.Card(), m)
+	if !ok {
+		return v, nil
+	}
+
+	if x.CVV != "" {
+		v.CVV = x.CVV
+	}
+
+	if x.AVS != "" {
+		v.AVS = x.AVS
+	}
+
+	return v, s.reply("verify", x, c.Card(), m)
+}
+
+func (s *Simulator) Increment(c domain.Card, m domain.Money) error {
+	return s.respond("increment", c, m)
+}
+
+func (s *Simulator) Reverse(c domain.Card, m domain.Money) error {
+	return s.respond("reverse", c, m)
+}
+
+func (s *Simulator) Capture(c domain.Card, m domain.Money) error {
+	return s.respond("capture", c, m)
+}
+
+func (s *Simulator) Refund(c domain.Card, m domain.Money) error {
+	return s.respond("refund", c, m)
+}
+
+func (s *Simulator) respond(operation string, c domain.Card, m domain.Money) error {
+	x, ok := s.match(operation, c, m)
+	if !ok {
+		return nil
+	}
+
+	return s.reply(operation, x, c, m)
+}
+
+func (s *Simulator) reply(operation string, x Scenario, c domain.Card, m domain.Money) error {
+	time.Sleep(time.Duration(x.Delay))
+	switch {
+	case x.Timeout:
+		return domain.NewDecline("68")
+	case x.Decline != "":
+		slog("DBG %s %s of %s declined with %s", operation, c.Masked(), m, x.Decline)
+		return domain.NewDecline(x.Decline)
+	}
+
+	return nil
+}
+
+func (s *Simulator) match(operation string, c domain.Card, m domain.Money) (Scenario, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, x := range s.scenarios {
+		switch {
+		case x.Operation != "" && x.Operation != operation:
+		case x.fingerprint != "" && x.fingerprint != c.Fingerprint():
+		case x.Amount.Currency() != "" && x.Amount != m:
+		case x.Above.Currency() != "" && (x.Above.Currency() != m.Currency() || x.Above.Minor() >= m.Minor()):
+		case x.Cents != "" && !strings.HasSuffix(strconv.FormatInt(m.Minor(), 10), x.Cents):
+		case x.Probability != 0 && s.random.Float64() >= x.Probability:
+		default:
+			return x, true
+		}
+	}
+
+	return Scenario{}, false
+}
+
+// Duration is time.Duration written as string, ie 1.5s.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(v)
+	return nil
+}
+
+// DefaultScenarios decline test cards known from payment gateways.
+var DefaultScenarios = []Scenario{
+	{Operation: "authorize", PAN: "4000000000000119", Decline: "05"},
+	{Operation: "capture", PAN: "4000000000000259", Decline: "05"},
+	{Operation: "refund", PAN: "4000000000003238", Decline: "05"},
+	{Operation: "verify", PAN: "4000000000000101", CVV: domain.Mismatched},
+}
+
+var slog = DefaultLogger.Tag("Simulator").Print
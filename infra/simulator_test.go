@@ -0,0 +1,102 @@
+package infra
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"payment/domain"
+)
+
+func TestSimulator(t *testing.T) {
+	type (
+		have struct {
+			number, amount, currency string
+		}
+
+		want string
+
+		case_ struct {
+			description string
+			have
+			want
+		}
+	)
+
+	money := func(a, c string) domain.Money {
+		m, err := domain.NewMoney(a, c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+
+	s, err := NewSimulator(1, append(DefaultScenarios,
+		Scenario{Operation: "authorize", Above: money("1000", "USD"), Decline: "51"},
+		Scenario{Amount: money("66.60", "EUR"), Decline: "59"},
+		Scenario{Cents: "91", Decline: "91", Probability: 1},
+		Scenario{Cents: "68", Timeout: true, Delay: Duration(time.Millisecond)},
+		Scenario{Cents: "11", Probability: 0.000001, Decline: "96"},
+	)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scenario := []case_{
+		{"any card gives approval", have{"4000000000000044", "10", "USD"}, ""},
+		{"failing authorization card gives 05", have{"4000000000000119", "10", "USD"}, "05"},
+		{"failing capture card gives approval", have{"4000000000000259", "10", "USD"}, ""},
+		{"amount above limit gives 51", have{"4000000000000044", "1000.01", "USD"}, "51"},
+		{"amount of limit gives approval", have{"4000000000000044", "1000", "USD"}, ""},
+		{"amount above limit in other currency gives approval", have{"4000000000000044", "1001", "EUR"}, ""},
+		{"exact amount gives 59", have{"4000000000000044", "66.6", "EUR"}, "59"},
+		{"cents pattern gives 91", have{"4000000000000044", "3.91", "USD"}, "91"},
+		{"timeout gives 68", have{"4000000000000044", "1.68", "GBP"}, "68"},
+		{"unlikely soft decline gives approval", have{"4000000000000044", "1.11", "GBP"}, ""},
+	}
+
+	for _, c := range scenario {
+		t.Run(c.description, func(t *testing.T) {
+			card, err := domain.NewCreditCard("Tom", c.have.number, "04/2099", "123")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var d = new(domain.Error)
+			if err = s.Authorize(card, money(c.have.amount, c.have.currency)); err != nil && !errors.As(err, &d) {
+				t.Fatal(err)
+			}
+
+			if d.Response != string(c.want) {
+				t.Fatalf("expected:%v got:%v", c.want, d.Response)
+			}
+		})
+	}
+}
+
+func TestSimulator_Verify(t *testing.T) {
+	s, err := NewSimulator(1, DefaultScenarios...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := domain.NewMoney("0", "USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for number, want := range map[string]domain.Verification{
+		"4000000000000044": {CVV: domain.Matched, AVS: domain.Matched},
+		"4000000000000101": {CVV: domain.Mismatched, AVS: domain.Matched},
+	} {
+		card, err := domain.NewCreditCard("Tom", number, "04/2099", "123")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		v, err := s.Verify(card, m, domain.Address{Line: "1 Main St", PostalCode: "10001"})
+		if err != nil || v != want {
+			t.Fatalf("expected:%v got:%v %v", want, v, err)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package infra
+
+import (
+	"sync"
+	"time"
+)
+
+// Snapshots is Store, which keeps snapshot of Aggregate state every n events of
+// its stream, so read restores latest snapshot and replays newer events only.
+//
+// Snapshots are kept by underlying Store, when it is able to (SQL), otherwise in
+// memory. Snapshot of other schema version than Aggregate's one is discarded.
+// Feed of underlying Store is given as is.
+type Snapshots struct {
+	Store
+	every     int
+	snapshots snapshotStore
+}
+
+// NewSnapshots of s taken every n events.
+func NewSnapshots(s Store, n int) *Snapshots {
+	r := &Snapshots{Store: s, every: n}
+	if x, ok := s.(snapshotStore); ok {
+		r.snapshots = x
+	} else {
+		r.snapshots = &memorySnapshots{m: map[string]snapshot{}}
+	}
+
+	return r
+}
+
+func (r *Snapshots) read(a Aggregate) error {
+	x, ok := a.(snapshotter)
+	if !ok {
+		return r.Store.read(a)
+	}
+
+	s, ok, err := r.snapshots.loadSnapshot(a.ID())
+	if err != nil {
+		return err
+	}
+
+	if ok {
+		if err = x.Restore(s.schema, s.data); err != nil {
+			log("INF snapshot #%s v%d discarded due %s", s.stream, s.version, err)
+			if err = r.snapshots.dropSnapshot(s.stream); err != nil {
+				return err
+			}
+		}
+	}
+
+	return r.Store.read(a)
+}
+
+// write events of a, snapshot is taken when they cross multiple of n. Failed
+// snapshot does not fail write, as events are written already.
+func (r *Snapshots) write(a Aggregate) error {
+	v := a.Version()
+	if err := r.Store.write(a); err != nil {
+		return err
+	}
+
+	x, ok := a.(snapshotter)
+	if !ok || r.every <= 0 || a.Version()/r.every == v/r.every {
+		return nil
+	}
+
+	schema, b, err := x.Snapshot()
+	if err == nil {
+		err = r.snapshots.saveSnapshot(snapshot{a.ID(), a.Version(), schema, b, time.Now().UTC()})
+	}
+
+	if err != nil {
+		log("ERR snapshot #%s v%d failed due %s", a.ID(), a.Version(), err)
+	}
+
+	return nil
+}
+
+// snapshotter is Aggregate, which state can be snapshot.
+type snapshotter interface {
+	Snapshot() (int, []byte, error)
+	Restore(int, []byte) error
+}
+
+// snapshot of stream at version, data is state of Aggregate in schema version.
+type snapshot struct {
+	stream    string
+	version   int
+	schema    int
+	data      []byte
+	createdAt time.Time
+}
+
+// snapshotStore keeps latest snapshot of every stream.
+type snapshotStore interface {
+	loadSnapshot(stream string) (snapshot, bool, error)
+	// saveSnapshot replaces older snapshot of stream only.
+	saveSnapshot(snapshot) error
+	dropSnapshot(stream string) error
+}
+
+type memorySnapshots struct {
+	mu sync.RWMutex
+	m  map[string]snapshot
+}
+
+func (r *memorySnapshots) loadSnapshot(stream string) (snapshot, bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	s, ok := r.m[stream]
+	return s, ok, nil
+}
+
+func (r *memorySnapshots) saveSnapshot(s snapshot) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if s.version > r.m[s.stream].version {
+		r.m[s.stream] = s
+	}
+
+	return nil
+}
+
+func (r *memorySnapshots) dropSnapshot(stream string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.m, stream)
+	return nil
+}
@@ -0,0 +1,102 @@
+package infra
+
+import (
+	"testing"
+	"time"
+
+	"payment/domain"
+)
+
+func TestSnapshots(t *testing.T) {
+	testStore(t, func(*testing.T) Store { return NewSnapshots(NewEvents(), 3) })
+}
+
+func TestSnapshots_SQL(t *testing.T) {
+	testStore(t, func(t *testing.T) Store {
+		s, err := OpenSQL("sqlite3", newTestSQLite(t))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		t.Cleanup(func() { s.Close() })
+		return NewSnapshots(s, 3)
+	})
+}
+
+func TestSnapshots_Read(t *testing.T) {
+	s, err := OpenSQL("sqlite3", newTestSQLite(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	j, err := OpenJournal(t.TempDir(), FsyncNever, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	type case_ struct {
+		description string
+		store       Store
+		schema      int
+		want        int
+	}
+
+	for _, c := range []case_{
+		{"memory snapshot gives newer events only", NewSnapshots(NewEvents(), 3), domain.SnapshotVersion, 2},
+		{"sql snapshot gives newer events only", NewSnapshots(s, 3), domain.SnapshotVersion, 2},
+		{"journal gives events newer than snapshot only", NewSnapshots(j, 3), domain.SnapshotVersion, 2},
+		{"snapshot of other schema is discarded", NewSnapshots(NewEvents(), 3), domain.SnapshotVersion + 1, 5},
+	} {
+		t.Run(c.description, func(t *testing.T) {
+			r := c.store.(*Snapshots)
+			ts := NewTransactions(r)
+			id := newTestTransaction(t, ts)
+			for i := 0; i < 4; i++ {
+				if err := capture(ts, id, newTestMoney(t, "10", "USD")); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			x, ok, err := r.snapshots.loadSnapshot(string(id))
+			if err != nil || !ok || x.version != 3 {
+				t.Fatalf("expected snapshot of version 3 got:%v %v", x.version, err)
+			}
+
+			x.schema = c.schema
+			if err = r.snapshots.dropSnapshot(x.stream); err != nil {
+				t.Fatal(err)
+			}
+
+			if err = r.snapshots.saveSnapshot(x); err != nil {
+				t.Fatal(err)
+			}
+
+			a, _ := domain.NewTransaction(id)
+			n := &counted{Transaction: a}
+			if err = r.read(n); err != nil {
+				t.Fatal(err)
+			}
+
+			if n.n != c.want || a.Version() != 5 || len(a.Captures()) != 4 {
+				t.Fatalf("expected:%v got:%v %v", c.want, n.n, a.Captures())
+			}
+
+			if _, ok, _ = r.snapshots.loadSnapshot(string(id)); ok != (c.schema == domain.SnapshotVersion) {
+				t.Fatalf("expected snapshot kept:%v", !ok)
+			}
+		})
+	}
+}
+
+// counted Transaction counts committed events.
+type counted struct {
+	*domain.Transaction
+	n int
+}
+
+func (c *counted) Commit(e event, at time.Time) error {
+	c.n++
+	return c.Transaction.Commit(e, at)
+}
@@ -0,0 +1,611 @@
+package infra
+
+import (
+	"database/sql"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"payment/domain"
+)
+
+// SQL is Store of Aggregate's events in relational database.
+//
+// Table streams keeps version of every Aggregate, it is compared and set on
+// write, so Optimistic Concurrency Control holds across processes sharing
+// database. Table events keeps events under global position, unique by stream
+// and version. Schema is created and upgraded by migrations on open.
+//
+// SQL is Feed of Subscriptions in order of position and keeps their
+// checkpoints. Writes of other processes are noticed by polling. Positions are
+// taken from counter in table feed, its row stays locked until write commits,
+// so they are given in order of commits and without gaps.
+//
+// SQL keeps merchant references and expiry schedule of Transactions too, so
+// they survive restart and are shared by processes as events are.
+type SQL struct {
+	db      *sql.DB
+	dialect dialect
+	signal  signal
+	locks   *Locks
+}
+
+// OpenSQL opens database of driver, which has to be registered, and migrates
+// its schema. Drivers sqlite3, postgres, pgx and mysql are supported, mysql
+// requires parseTime=true in dsn.
+func OpenSQL(driver, dsn string) (*SQL, error) {
+	d, ok := dialects[driver]
+	if !ok {
+		return nil, domain.Err("%w %s", errSQLDriver, driver)
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &SQL{db: db, dialect: d, locks: NewLocks()}
+	if err = s.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *SQL) Close() error {
+	return s.db.Close()
+}
+
+func (s *SQL) read(a Aggregate) error {
+	rows, err := s.db.Query(s.dialect.bind(`SELECT name, schema_version, data, created_at FROM events WHERE stream = ? AND version > ? ORDER BY version`), a.ID(), a.Version())
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var n, b string
+		var x int
+		var t time.Time
+		if err = rows.Scan(&n, &x, &b, &t); err != nil {
+			return err
+		}
+
+		var p payload
+		if err = p.UnmarshalJSON([]byte(b)); err != nil {
+			return err
+		}
+
+		v, err := events.decode(n, x, p)
+		if err != nil {
+			return err
+		}
+
+		if err = a.Commit(v, t); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func (s *SQL) write(a Aggregate) error {
+	n := time.Now().UTC()
+	id := a.ID()
+	l := a.Uncommitted(false)
+	if len(l) == 0 {
+		return nil
+	}
+
+	v := a.Version()
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err = s.append(tx, id, v, l, n); err != nil {
+		tx.Rollback()
+		return s.conflict(id, v, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return s.conflict(id, v, err)
+	}
+
+	s.signal.notify()
+
+	for _, e := range a.Uncommitted(true) {
+		if err = a.Commit(e, n); err != nil {
+			return err
+		}
+
+		log("DBG #%s|%s", id, reflect.TypeOf(e).Name())
+	}
+
+	return nil
+}
+
+// append events l of stream id at version v, stream row is inserted or
+// compared and set first, so concurrent writers wait for each other or fail.
+func (s *SQL) append(tx *sql.Tx, id string, v int, l []event, n time.Time) error {
+	if v == 0 {
+		if _, err := tx.Exec(s.dialect.bind(`INSERT INTO streams (id, version) VALUES (?, ?)`), id, len(l)); err != nil {
+			return err
+		}
+	} else {
+		r, err := tx.Exec(s.dialect.bind(`UPDATE streams SET version = ? WHERE id = ? AND version = ?`), v+len(l), id, v)
+		if err != nil {
+			return err
+		}
+
+		if c, err := r.RowsAffected(); err != nil || c != 1 {
+			return errVersionStale
+		}
+	}
+
+	// counter is taken last, so it is locked for as short as possible
+	if _, err := tx.Exec(s.dialect.bind(`UPDATE feed SET position = position + ? WHERE id = 1`), len(l)); err != nil {
+		return err
+	}
+
+	var p int64
+	if err := tx.QueryRow(`SELECT position FROM feed WHERE id = 1`).Scan(&p); err != nil {
+		return err
+	}
+
+	p -= int64(len(l))
+	q := s.dialect.bind(`INSERT INTO events (position, stream, version, name, schema_version, data, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)`)
+	for i, e := range l {
+		name, x, b, err := events.encode(e)
+		if err != nil {
+			return err
+		}
+
+		// binary payload is kept as base64, so data column stays text
+		d, err := payload(b).MarshalJSON()
+		if err != nil {
+			return err
+		}
+
+		if _, err = tx.Exec(q, p+int64(i)+1, id, v+i+1, name, x, string(d), n); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// conflict tells whether failed write of stream at version v lost race with
+// another one, so violations of constraints are told apart in portable way.
+func (s *SQL) conflict(id string, v int, err error) error {
+	var a int
+	x := s.db.QueryRow(s.dialect.bind(`SELECT version FROM streams WHERE id = ?`), id).Scan(&a)
+	if x != nil && x != sql.ErrNoRows {
+		return err
+	}
+
+	if a != v {
+		return domain.VersionConflictError{Stream: id, Expected: v, Actual: a}
+	}
+
+	return err
+}
+
+// Lock stream of id across processes sharing database. Lock is lease in table
+// locks, so one of crashed process is taken over when lease expires. Commands
+// of the same process wait for each other in memory first.
+func (s *SQL) Lock(id domain.ID) (func(), error) {
+	u, _ := s.locks.Lock(id)
+	o := domain.NewID()
+	for d := time.Now().Add(lease); ; time.Sleep(10 * time.Millisecond) {
+		ok, err := s.lease(id, o)
+		if err != nil {
+			u()
+			return nil, err
+		}
+
+		if ok {
+			break
+		}
+
+		if time.Now().After(d) {
+			u()
+			return nil, errSQLLocked
+		}
+	}
+
+	return func() {
+		if _, err := s.db.Exec(s.dialect.bind(`DELETE FROM locks WHERE stream = ? AND owner = ?`), id, o); err != nil {
+			log("ERR lock #%s not released due %s", id, err)
+		}
+
+		u()
+	}, nil
+}
+
+// lease lock of stream id to owner, when it is free or lease of another owner
+// expired.
+func (s *SQL) lease(id, owner domain.ID) (bool, error) {
+	n := time.Now().UTC()
+	r, err := s.db.Exec(s.dialect.bind(`UPDATE locks SET owner = ?, expires_at = ? WHERE stream = ? AND expires_at < ?`), owner, n.Add(lease), id, n)
+	if err != nil {
+		return false, err
+	}
+
+	if c, err := r.RowsAffected(); err != nil || c == 1 {
+		return c == 1, err
+	}
+
+	_, err = s.db.Exec(s.dialect.bind(`INSERT INTO locks (stream, owner, expires_at) VALUES (?, ?, ?)`), id, owner, n.Add(lease))
+	if err == nil {
+		return true, nil
+	}
+
+	// insert fails when lock is held by another owner
+	var x string
+	if s.db.QueryRow(s.dialect.bind(`SELECT owner FROM locks WHERE stream = ?`), id).Scan(&x) == nil {
+		return false, nil
+	}
+
+	return false, err
+}
+
+func (s *SQL) records(after int64, n int) ([]Record, error) {
+	rows, err := s.db.Query(s.dialect.bind(`SELECT position, stream, version, name, schema_version, data, created_at FROM events WHERE position > ? ORDER BY position LIMIT ?`), after, n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var l []Record
+	for rows.Next() {
+		var r Record
+		var x int
+		var b string
+		if err = rows.Scan(&r.Position, &r.Stream, &r.Version, &r.Name, &x, &b, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		var p payload
+		if err = p.UnmarshalJSON([]byte(b)); err != nil {
+			return nil, err
+		}
+
+		if r.Event, err = events.decode(r.Name, x, p); err != nil {
+			return nil, err
+		}
+
+		l = append(l, r)
+	}
+
+	return l, rows.Err()
+}
+
+func (s *SQL) changed() <-chan struct{} {
+	return s.signal.changed()
+}
+
+func (s *SQL) load(subscriber string) (int64, error) {
+	var p int64
+	err := s.db.QueryRow(s.dialect.bind(`SELECT position FROM checkpoints WHERE subscriber = ?`), subscriber).Scan(&p)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+
+	return p, err
+}
+
+// save position of subscriber, row is updated or inserted on first save.
+func (s *SQL) save(subscriber string, position int64) error {
+	r, err := s.db.Exec(s.dialect.bind(`UPDATE checkpoints SET position = ? WHERE subscriber = ?`), position, subscriber)
+	if err != nil {
+		return err
+	}
+
+	if c, err := r.RowsAffected(); err != nil || c != 0 {
+		return err
+	}
+
+	// mysql tells no rows affected by update to the same position as well
+	_, err = s.db.Exec(s.dialect.bind(`INSERT INTO checkpoints (subscriber, position) VALUES (?, ?)`), subscriber, position)
+	if p, x := s.load(subscriber); err != nil && x == nil && p == position {
+		return nil
+	}
+
+	return err
+}
+
+func (s *SQL) Reserve(merchant, ref string, id domain.ID) error {
+	_, err := s.db.Exec(s.dialect.bind(`INSERT INTO merchant_references (merchant, reference, transaction_id) VALUES (?, ?, ?)`), merchant, ref, id)
+	if err == nil {
+		return nil
+	}
+
+	// insert fails when reference is taken already
+	if _, x := s.Find(merchant, ref); x == nil {
+		return errReferenceTaken
+	}
+
+	return err
+}
+
+func (s *SQL) Release(merchant, ref string) error {
+	_, err := s.db.Exec(s.dialect.bind(`DELETE FROM merchant_references WHERE merchant = ? AND reference = ?`), merchant, ref)
+	return err
+}
+
+func (s *SQL) Find(merchant, ref string) (domain.ID, error) {
+	var id domain.ID
+	err := s.db.QueryRow(s.dialect.bind(`SELECT transaction_id FROM merchant_references WHERE merchant = ? AND reference = ?`), merchant, ref).Scan(&id)
+	if err == sql.ErrNoRows {
+		return "", errReferenceNotFound
+	}
+
+	return id, err
+}
+
+// Add due moment of transaction, row is updated or inserted on first add.
+func (s *SQL) Add(id domain.ID, at time.Time) error {
+	at = at.UTC()
+	r, err := s.db.Exec(s.dialect.bind(`UPDATE schedule SET due_at = ? WHERE transaction_id = ?`), at, id)
+	if err != nil {
+		return err
+	}
+
+	if c, err := r.RowsAffected(); err != nil || c != 0 {
+		return err
+	}
+
+	// mysql tells no rows affected by update to the same moment as well
+	_, err = s.db.Exec(s.dialect.bind(`INSERT INTO schedule (transaction_id, due_at) VALUES (?, ?)`), id, at)
+	var x time.Time
+	if err != nil && s.db.QueryRow(s.dialect.bind(`SELECT due_at FROM schedule WHERE transaction_id = ?`), id).Scan(&x) == nil && x.Equal(at) {
+		return nil
+	}
+
+	return err
+}
+
+// Due gives transactions which are due before given moment, earliest first.
+func (s *SQL) Due(at time.Time) ([]domain.ID, error) {
+	rows, err := s.db.Query(s.dialect.bind(`SELECT transaction_id FROM schedule WHERE due_at <= ? ORDER BY due_at`), at.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var l []domain.ID
+	for rows.Next() {
+		var id domain.ID
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+
+		l = append(l, id)
+	}
+
+	return l, rows.Err()
+}
+
+func (s *SQL) Remove(id domain.ID) error {
+	_, err := s.db.Exec(s.dialect.bind(`DELETE FROM schedule WHERE transaction_id = ?`), id)
+	return err
+}
+
+func (s *SQL) loadSnapshot(stream string) (snapshot, bool, error) {
+	var b string
+	x := snapshot{stream: stream}
+	err := s.db.QueryRow(s.dialect.bind(`SELECT version, schema_version, data, created_at FROM snapshots WHERE stream = ?`), stream).
+		Scan(&x.version, &x.schema, &b, &x.createdAt)
+	if err == sql.ErrNoRows {
+		return snapshot{}, false, nil
+	}
+
+	x.data = []byte(b)
+	return x, err == nil, err
+}
+
+// saveSnapshot updates older snapshot of stream or inserts first one, insert
+// losing race with another one is ignored.
+func (s *SQL) saveSnapshot(x snapshot) error {
+	r, err := s.db.Exec(s.dialect.bind(`UPDATE snapshots SET version = ?, schema_version = ?, data = ?, created_at = ? WHERE stream = ? AND version < ?`),
+		x.version, x.schema, string(x.data), x.createdAt, x.stream, x.version)
+	if err != nil {
+		return err
+	}
+
+	if c, err := r.RowsAffected(); err != nil || c != 0 {
+		return err
+	}
+
+	var v int
+	err = s.db.QueryRow(s.dialect.bind(`SELECT version FROM snapshots WHERE stream = ?`), x.stream).Scan(&v)
+	if err != sql.ErrNoRows {
+		return err
+	}
+
+	_, err = s.db.Exec(s.dialect.bind(`INSERT INTO snapshots (stream, version, schema_version, data, created_at) VALUES (?, ?, ?, ?, ?)`),
+		x.stream, x.version, x.schema, string(x.data), x.createdAt)
+	if err != nil {
+		log("INF snapshot #%s v%d not saved due %s", x.stream, x.version, err)
+	}
+
+	return nil
+}
+
+func (s *SQL) dropSnapshot(stream string) error {
+	_, err := s.db.Exec(s.dialect.bind(`DELETE FROM snapshots WHERE stream = ?`), stream)
+	return err
+}
+
+// migrate applies migrations not recorded in schema_migrations yet, each one
+// in own transaction.
+func (s *SQL) migrate() error {
+	if _, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`); err != nil {
+		return err
+	}
+
+	var v int
+	if err := s.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&v); err != nil {
+		return err
+	}
+
+	for i := v; i < len(migrations); i++ {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+
+		for _, q := range migrations[i] {
+			if _, err = tx.Exec(s.dialect.replace(q)); err != nil {
+				tx.Rollback()
+				return domain.Err("%w %d: %s", errSQLMigration, i+1, err)
+			}
+		}
+
+		if _, err = tx.Exec(s.dialect.bind(`INSERT INTO schema_migrations (version) VALUES (?)`), i+1); err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+
+		log("INF schema migrated to version %d", i+1)
+	}
+
+	return nil
+}
+
+// migrations of schema, i-th one migrates to version i+1, applied ones must
+// never change. Types in braces are replaced with ones of dialect.
+var migrations = [][]string{
+	{
+		`CREATE TABLE streams (
+			id VARCHAR(64) PRIMARY KEY,
+			version INTEGER NOT NULL
+		)`,
+		`CREATE TABLE events (
+			position {serial},
+			stream VARCHAR(64) NOT NULL,
+			version INTEGER NOT NULL,
+			name VARCHAR(64) NOT NULL,
+			data {text} NOT NULL,
+			created_at {timestamp} NOT NULL,
+			CONSTRAINT events_stream_version UNIQUE (stream, version)
+		)`,
+	},
+	{
+		`ALTER TABLE events ADD COLUMN schema_version INTEGER NOT NULL DEFAULT 1`,
+	},
+	{
+		`CREATE TABLE snapshots (
+			stream VARCHAR(64) PRIMARY KEY,
+			version INTEGER NOT NULL,
+			schema_version INTEGER NOT NULL,
+			data {text} NOT NULL,
+			created_at {timestamp} NOT NULL
+		)`,
+	},
+	{
+		`CREATE TABLE checkpoints (
+			subscriber VARCHAR(64) PRIMARY KEY,
+			position BIGINT NOT NULL
+		)`,
+	},
+	{
+		`CREATE TABLE locks (
+			stream VARCHAR(64) PRIMARY KEY,
+			owner VARCHAR(64) NOT NULL,
+			expires_at {timestamp} NOT NULL
+		)`,
+	},
+	{
+		`CREATE TABLE feed (
+			id INTEGER PRIMARY KEY,
+			position BIGINT NOT NULL
+		)`,
+		`INSERT INTO feed (id, position) SELECT 1, COALESCE(MAX(position), 0) FROM events`,
+	},
+	{
+		`CREATE TABLE merchant_references (
+			merchant VARCHAR(64) NOT NULL,
+			reference VARCHAR(255) NOT NULL,
+			transaction_id VARCHAR(64) NOT NULL,
+			PRIMARY KEY (merchant, reference)
+		)`,
+		`CREATE TABLE schedule (
+			transaction_id VARCHAR(64) PRIMARY KEY,
+			due_at {timestamp} NOT NULL
+		)`,
+	},
+}
+
+// lease of stream lock, it has to be longer than any command of Transaction.
+var lease = time.Minute
+
+// dialect of SQL, it differs in placeholders and types only.
+type dialect struct {
+	numbered bool
+	types    map[string]string
+}
+
+// bind placeholders of query, ? are numbered as $1, $2... when dialect requires.
+func (d dialect) bind(q string) string {
+	if !d.numbered {
+		return q
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range q {
+		if r != '?' {
+			b.WriteRune(r)
+			continue
+		}
+
+		n++
+		b.WriteString("$" + strconv.Itoa(n))
+	}
+
+	return b.String()
+}
+
+func (d dialect) replace(q string) string {
+	for k, v := range d.types {
+		q = strings.ReplaceAll(q, "{"+k+"}", v)
+	}
+
+	return q
+}
+
+var postgres = dialect{numbered: true, types: map[string]string{
+	"serial":    "BIGSERIAL PRIMARY KEY",
+	"text":      "TEXT",
+	"timestamp": "TIMESTAMPTZ",
+}}
+
+var dialects = map[string]dialect{
+	"sqlite3": {types: map[string]string{
+		"serial":    "INTEGER PRIMARY KEY AUTOINCREMENT",
+		"text":      "TEXT",
+		"timestamp": "TIMESTAMP",
+	}},
+	"postgres": postgres,
+	"pgx":      postgres,
+	"mysql": {types: map[string]string{
+		"serial":    "BIGINT AUTO_INCREMENT PRIMARY KEY",
+		"text":      "LONGTEXT",
+		"timestamp": "DATETIME(6)",
+	}},
+}
+
+var (
+	errSQLDriver    = domain.Err("sql: unsupported driver")
+	errSQLMigration = domain.Err("sql: migration failed")
+	errVersionStale = domain.Err("sql: stale version of stream")
+	errSQLLocked    = domain.NewError(domain.Conflict, "transaction_locked", "sql: transaction locked by another command")
+)
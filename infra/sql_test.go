@@ -0,0 +1,132 @@
+package infra
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestSQL(t *testing.T) {
+	testStore(t, func(t *testing.T) Store {
+		s, err := OpenSQL("sqlite3", newTestSQLite(t))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		t.Cleanup(func() { s.Close() })
+		return s
+	})
+}
+
+func TestSQL_Migrate(t *testing.T) {
+	d := newTestSQLite(t)
+	s, err := OpenSQL("sqlite3", d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := newTestTransaction(t, NewTransactions(s))
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// applied migrations are skipped on reopen
+	if s, err = OpenSQL("sqlite3", d); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	var v int
+	if err = s.db.QueryRow(`SELECT MAX(version) FROM schema_migrations`).Scan(&v); err != nil || v != len(migrations) {
+		t.Fatalf("expected:%v got:%v %v", len(migrations), v, err)
+	}
+
+	a, err := NewTransactions(s).Read(id)
+	if err != nil || a.Version() != 1 {
+		t.Fatalf("expected:%v got:%v %v", 1, a, err)
+	}
+}
+
+func TestSQL_Feed(t *testing.T) {
+	d := newTestSQLite(t)
+	m := migrations
+	defer func() { migrations = m }()
+
+	// events written before feed counter was introduced by 6th migration
+	migrations = m[:5]
+	s, err := OpenSQL("sqlite3", d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = s.db.Exec(`INSERT INTO events (position, stream, version, name, data, created_at) VALUES (7, 'a', 1, 'TransactionVoided', '{}', ?)`, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	migrations = m
+	if s, err = OpenSQL("sqlite3", d); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	newTestTransaction(t, NewTransactions(s))
+	l, err := s.records(0, 10)
+	if err != nil || len(l) != 2 || l[0].Position != 7 || l[1].Position != 8 {
+		t.Fatalf("expected:[7 8] got:%v %v", l, err)
+	}
+}
+
+func TestSQL_Gob(t *testing.T) {
+	SetEventFormat(Gob)
+	defer SetEventFormat(JSON)
+
+	s, err := OpenSQL("sqlite3", newTestSQLite(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	r := NewTransactions(s)
+	id := newTestTransaction(t, r)
+	if err = capture(r, id, newTestMoney(t, "10", "USD")); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := r.Read(id)
+	if err != nil || a.Version() != 2 || a.Captured().String() != "10.00USD" {
+		t.Fatalf("expected:%v got:%v %v", "10.00USD", a, err)
+	}
+}
+
+func TestDialect_Bind(t *testing.T) {
+	type case_ struct {
+		have dialect
+		want string
+	}
+
+	q := `UPDATE streams SET version = ? WHERE id = ? AND version = ?`
+	for _, c := range []case_{
+		{dialects["sqlite3"], q},
+		{dialects["mysql"], q},
+		{dialects["postgres"], `UPDATE streams SET version = $1 WHERE id = $2 AND version = $3`},
+	} {
+		if r := c.have.bind(q); r != c.want {
+			t.Fatalf("expected:%v got:%v", c.want, r)
+		}
+	}
+}
+
+func TestOpenSQL_Driver(t *testing.T) {
+	if _, err := OpenSQL("oracle", ""); err == nil {
+		t.Fatalf("expected:%v got:%v", errSQLDriver, err)
+	}
+}
+
+// newTestSQLite gives dsn of SQLite database in temporary directory, writers
+// wait for lock instead of failing with database is locked.
+func newTestSQLite(t *testing.T) string {
+	return "file:" + filepath.Join(t.TempDir(), "events.db") + "?_busy_timeout=10000&_txlock=immediate&_journal_mode=WAL"
+}
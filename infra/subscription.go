@@ -0,0 +1,250 @@
+package infra
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Record is event of Aggregate's stream at global Position of Store, positions
+// start at 1 and only grow.
+type Record struct {
+	Position  int64
+	Stream    string
+	Version   int
+	Name      string
+	Event     event
+	CreatedAt time.Time
+}
+
+// Feed is Store, which gives events of all streams in order of global position.
+type Feed interface {
+	// records after position, at most n of them.
+	records(after int64, n int) ([]Record, error)
+	// changed is closed when events are written after it was given.
+	changed() <-chan struct{}
+}
+
+// Subscription delivers Records of Feed to handler, ones written before it
+// started first (catch up), then ones written since (live), both by the same
+// loop, so no Record is skipped on switch.
+//
+// Handler is called by single goroutine in order of positions. Position of
+// subscriber is checkpointed after every batch, so after restart Records are
+// delivered from checkpoint at least once. Failed Record is retried later.
+type Subscription struct {
+	feed        Feed
+	checkpoints Checkpoints
+	subscriber  string
+	handler     func(Record) error
+	mu          sync.Mutex
+	position    int64
+	done        chan struct{}
+	stopped     chan struct{}
+}
+
+// Subscribe subscriber to f from its checkpoint in c.
+func Subscribe(f Feed, c Checkpoints, subscriber string, h func(Record) error) (*Subscription, error) {
+	p, err := c.load(subscriber)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Subscription{
+		feed:        f,
+		checkpoints: c,
+		subscriber:  subscriber,
+		handler:     h,
+		position:    p,
+		done:        make(chan struct{}),
+		stopped:     make(chan struct{}),
+	}
+
+	go s.run()
+	return s, nil
+}
+
+// Position of last handled Record.
+func (s *Subscription) Position() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.position
+}
+
+// Close stops delivery and waits for handler to return.
+func (s *Subscription) Close() {
+	select {
+	case <-s.done:
+	default:
+		close(s.done)
+	}
+
+	<-s.stopped
+}
+
+func (s *Subscription) run() {
+	defer close(s.stopped)
+
+	t := time.NewTicker(poll)
+	defer t.Stop()
+
+	for {
+		// taken before read, so write done meanwhile is not missed
+		c := s.feed.changed()
+		n, err := s.deliver()
+		if err != nil {
+			log("ERR subscriber %s at %d failed due %s", s.subscriber, s.Position(), err)
+		}
+
+		if err == nil && n == batch {
+			select {
+			case <-s.done:
+				return
+			default:
+				continue
+			}
+		}
+
+		select {
+		case <-s.done:
+			return
+		case <-c:
+		case <-t.C:
+		}
+	}
+}
+
+// deliver batch of Records after position, number of delivered ones is given.
+func (s *Subscription) deliver() (int, error) {
+	p := s.Position()
+	l, err := s.feed.records(p, batch)
+	if err != nil {
+		return 0, err
+	}
+
+	var n int
+	for _, r := range l {
+		if err = s.handler(r); err != nil {
+			break
+		}
+
+		p = r.Position
+		n++
+	}
+
+	if n == 0 {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	s.position = p
+	s.mu.Unlock()
+
+	if x := s.checkpoints.save(s.subscriber, p); x != nil && err == nil {
+		err = x
+	}
+
+	return n, err
+}
+
+// Checkpoints keep positions of subscribers.
+type Checkpoints interface {
+	// load gives zero for new subscriber.
+	load(subscriber string) (int64, error)
+	save(subscriber string, position int64) error
+}
+
+// FileCheckpoints keeps positions in JSON file, it is replaced on every save.
+type FileCheckpoints struct {
+	mu        sync.Mutex
+	path      string
+	positions map[string]int64
+}
+
+// OpenCheckpoints of file at path, it is created on first save. Positions are
+// kept in memory only when path is empty.
+func OpenCheckpoints(path string) (*FileCheckpoints, error) {
+	c := &FileCheckpoints{path: path, positions: map[string]int64{}}
+	if path == "" {
+		return c, nil
+	}
+
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return c, json.Unmarshal(b, &c.positions)
+}
+
+func (c *FileCheckpoints) load(subscriber string) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.positions[subscriber], nil
+}
+
+func (c *FileCheckpoints) save(subscriber string, position int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.positions[subscriber] = position
+	if c.path == "" {
+		return nil
+	}
+
+	b, err := json.Marshal(c.positions)
+	if err != nil {
+		return err
+	}
+
+	t := c.path + ".tmp"
+	if err = os.WriteFile(t, b, 0600); err != nil {
+		return err
+	}
+
+	if err = os.Rename(t, c.path); err != nil {
+		return err
+	}
+
+	return syncDir(filepath.Dir(c.path))
+}
+
+// signal of writes to Feed, its channel is closed and replaced on every one.
+type signal struct {
+	mu sync.Mutex
+	c  chan struct{}
+}
+
+func (s *signal) changed() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.c == nil {
+		s.c = make(chan struct{})
+	}
+
+	return s.c
+}
+
+func (s *signal) notify() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.c != nil {
+		close(s.c)
+		s.c = nil
+	}
+}
+
+const batch = 256
+
+// poll of Feed, which may be written by other processes, ie SQL.
+var poll = time.Second
@@ -0,0 +1,268 @@
+package infra
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"payment/domain"
+)
+
+func TestSubscription(t *testing.T) {
+	for _, c := range []struct {
+		case_ string
+		open  func(*testing.T) (Store, Checkpoints)
+	}{
+		{"events", func(t *testing.T) (Store, Checkpoints) {
+			return NewEvents(), newTestCheckpoints(t)
+		}},
+		{"journal", func(t *testing.T) (Store, Checkpoints) {
+			j, err := OpenJournal(t.TempDir(), FsyncNever, 1024)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			t.Cleanup(func() { j.Close() })
+			return j, newTestCheckpoints(t)
+		}},
+		{"snapshots", func(t *testing.T) (Store, Checkpoints) {
+			return NewSnapshots(NewEvents(), 2), newTestCheckpoints(t)
+		}},
+		{"sql", func(t *testing.T) (Store, Checkpoints) {
+			s, err := OpenSQL("sqlite3", newTestSQLite(t))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			t.Cleanup(func() { s.Close() })
+			return s, s
+		}},
+	} {
+		t.Run(c.case_, func(t *testing.T) {
+			s, cp := c.open(t)
+			r := NewTransactions(s)
+			h := &testHandler{}
+
+			// history is caught up, then live events are delivered
+			for i := 0; i < 4; i++ {
+				newTestTransaction(t, r)
+			}
+
+			x, err := Subscribe(s, cp, "projection", h.handle)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ids := make([]domain.ID, 4)
+			for i := range ids {
+				ids[i] = newTestTransaction(t, r)
+			}
+
+			var wg sync.WaitGroup
+			for _, id := range ids {
+				wg.Add(1)
+				go func(id domain.ID) {
+					defer wg.Done()
+					if err := capture(r, id, newTestMoney(t, "10", "USD")); err != nil {
+						t.Error(err)
+					}
+				}(id)
+			}
+			wg.Wait()
+
+			waitPosition(t, x, 12)
+			x.Close()
+			h.check(t, 12)
+
+			// delivery resumes after checkpoint
+			newTestTransaction(t, r)
+			if x, err = Subscribe(s, cp, "projection", h.handle); err != nil {
+				t.Fatal(err)
+			}
+			defer x.Close()
+
+			waitPosition(t, x, 13)
+			h.check(t, 13)
+
+			// other subscriber starts from the beginning
+			o := &testHandler{}
+			y, err := Subscribe(s, cp, "webhooks", o.handle)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer y.Close()
+
+			waitPosition(t, y, 13)
+			o.check(t, 13)
+		})
+	}
+}
+
+func TestSubscription_Retry(t *testing.T) {
+	defer func(d time.Duration) { poll = d }(poll)
+	poll = 10 * time.Millisecond
+
+	s := NewEvents()
+	r := NewTransactions(s)
+	newTestTransaction(t, r)
+	newTestTransaction(t, r)
+
+	h := &testHandler{fail: 2}
+	x, err := Subscribe(s, newTestCheckpoints(t), "projection", h.handle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer x.Close()
+
+	waitPosition(t, x, 2)
+	h.check(t, 2)
+}
+
+func TestJournal_Records(t *testing.T) {
+	d := t.TempDir()
+	j, err := OpenJournal(d, FsyncAlways, 512)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewTransactions(j)
+	for i := 0; i < 4; i++ {
+		if err = capture(r, newTestTransaction(t, r), newTestMoney(t, "10", "USD")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	j.Close()
+
+	// positions are recovered on open
+	if j, err = OpenJournal(d, FsyncAlways, 512); err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	for _, c := range []struct {
+		case_ string
+		after int64
+		n     int
+		want  []int64
+	}{
+		{"all", 0, 10, []int64{1, 2, 3, 4, 5, 6, 7, 8}},
+		{"limit", 2, 3, []int64{3, 4, 5}},
+		{"end", 7, 3, []int64{8}},
+		{"none", 8, 3, nil},
+	} {
+		l, err := j.records(c.after, c.n)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var have []int64
+		for _, x := range l {
+			have = append(have, x.Position)
+		}
+
+		if len(have) != len(c.want) || (len(have) != 0 && (have[0] != c.want[0] || have[len(have)-1] != c.want[len(c.want)-1])) {
+			t.Fatalf("%s expected:%v got:%v", c.case_, c.want, have)
+		}
+	}
+}
+
+func TestOpenCheckpoints(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "checkpoints.json")
+	c, err := OpenCheckpoints(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = c.save("projection", 42); err != nil {
+		t.Fatal(err)
+	}
+
+	if c, err = OpenCheckpoints(p); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, x := range []struct {
+		case_ string
+		have  string
+		want  int64
+	}{
+		{"saved", "projection", 42},
+		{"new", "webhooks", 0},
+	} {
+		if have, err := c.load(x.have); err != nil || have != x.want {
+			t.Fatalf("%s expected:%v got:%v %v", x.case_, x.want, have, err)
+		}
+	}
+
+	// positions without file are kept in memory
+	if c, err = OpenCheckpoints(""); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = c.save("projection", 42); err != nil {
+		t.Fatal(err)
+	}
+
+	if have, err := c.load("projection"); err != nil || have != 42 {
+		t.Fatalf("expected:%v got:%v %v", 42, have, err)
+	}
+}
+
+// testHandler keeps handled Records, first fail calls fail.
+type testHandler struct {
+	mu      sync.Mutex
+	fail    int
+	records []Record
+}
+
+func (h *testHandler) handle(r Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.fail > 0 {
+		h.fail--
+		return errors.New("handler failed")
+	}
+
+	h.records = append(h.records, r)
+	return nil
+}
+
+// check that positions 1..n were handled once in order, versions of every
+// stream in order as well.
+func (h *testHandler) check(t *testing.T, n int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if int64(len(h.records)) != n {
+		t.Fatalf("expected:%v got:%v", n, len(h.records))
+	}
+
+	versions := map[string]int{}
+	for i, r := range h.records {
+		if r.Position != int64(i+1) || r.Version != versions[r.Stream]+1 || r.Event == nil {
+			t.Fatalf("expected:%v got:%+v", i+1, r)
+		}
+
+		versions[r.Stream] = r.Version
+	}
+}
+
+func waitPosition(t *testing.T, s *Subscription, p int64) {
+	for d := time.Now().Add(5 * time.Second); s.Position() < p; time.Sleep(time.Millisecond) {
+		if time.Now().After(d) {
+			t.Fatalf("expected:%v got:%v", p, s.Position())
+		}
+	}
+}
+
+func newTestCheckpoints(t *testing.T) *FileCheckpoints {
+	c, err := OpenCheckpoints(filepath.Join(t.TempDir(), "checkpoints.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
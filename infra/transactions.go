@@ -5,10 +5,10 @@ import (
 	"payment/domain"
 )
 
-type transactions struct{ Events }
+type transactions struct{ Store }
 
-func NewTransactions() app.Transactions {
-	return &transactions{make(Events)}
+func NewTransactions(s Store) app.Transactions {
+	return &transactions{s}
 }
 
 func (r transactions) Read(id domain.ID) (*domain.Transaction, error) {
@@ -0,0 +1,385 @@
+package infra
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"strconv"
+	"sync"
+
+	gonanoid "github.com/matoous/go-nanoid"
+	"payment/domain"
+)
+
+// Vault keeps CreditCards encrypted with AES-GCM and gives opaque CardToken in
+// exchange, the same card always gets the same CardToken. Cvv is never stored.
+//
+// Records are sealed with data keys of keyring, every record tells version of
+// its key, so records of retired key are opened until they are resealed.
+// Rotate introduces new random data key and reseals all records with it, keys
+// without records are discarded then. Data keys are sealed with master key,
+// which is never stored, so keyring is kept along with records.
+// Records live in memory and, when path is given, in JSON file which is
+// replaced atomically on every change, so they are restored after restart.
+type Vault struct {
+	mu      sync.RWMutex
+	path    string
+	master  cipher.AEAD
+	keys    map[int]vaultKey
+	version int
+	records map[domain.CardToken]record
+	tokens  map[string]domain.CardToken
+}
+
+// NewVault with 32 bytes long AES-256 master key, random key is generated when
+// none is given. Keyring and records of file at path are restored, they have
+// to be sealed with given master key, so random one is not possible with path.
+func NewVault(master []byte, path string) (*Vault, error) {
+	if master == nil && path != "" {
+		return nil, errVaultKeyRandom
+	}
+
+	m, err := newVaultCipher(master)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &Vault{
+		master:  m,
+		keys:    make(map[int]vaultKey),
+		records: make(map[domain.CardToken]record),
+		tokens:  make(map[string]domain.CardToken),
+	}
+
+	b, err := os.ReadFile(path)
+	if path == "" || errors.Is(err, fs.ErrNotExist) {
+		v.path = path
+		return v, v.Rotate()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var j jsonVault
+	if err = json.Unmarshal(b, &j); err != nil {
+		return nil, err
+	}
+
+	for _, x := range j.Keys {
+		k, err := v.unwrap(x)
+		if err != nil {
+			return nil, err
+		}
+
+		v.keys[x.Version] = k
+	}
+
+	v.version = j.Version
+	if _, ok := v.keys[v.version]; !ok {
+		return nil, errVaultKeyRetired
+	}
+
+	for _, x := range j.Records {
+		r := record{x.Version, x.Nonce, x.Data, x.Fingerprint}
+		if _, err = v.open(x.Token, r); err != nil {
+			return nil, err
+		}
+
+		v.records[x.Token], v.tokens[x.Fingerprint] = r, x.Token
+	}
+
+	v.path = path
+	vlog("INF %d records restored with key #%d", len(j.Records), v.version)
+	return v, nil
+}
+
+func (v *Vault) Tokenize(c domain.CreditCard) (domain.CardToken, error) {
+	if c.IsZero() {
+		return "", errVaultCard
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	f := c.Card().Fingerprint()
+	t, ok := v.tokens[f]
+	if !ok {
+		t = domain.CardToken("tok_" + gonanoid.MustID(24))
+	}
+
+	b, err := json.Marshal(jsonVaultCard{c.Owner(), c.Number(), c.Expiry()})
+	if err != nil {
+		return "", err
+	}
+
+	r, err := v.seal(t, b)
+	if err != nil {
+		return "", err
+	}
+
+	r.fingerprint = f
+	p, ok := v.records[t]
+	v.records[t], v.tokens[f] = r, t
+	if err = v.save(); err != nil {
+		if ok {
+			v.records[t] = p
+		} else {
+			delete(v.records, t)
+			delete(v.tokens, f)
+		}
+
+		return "", err
+	}
+
+	vlog("DBG %s stored with key #%d", t, r.version)
+
+	return t, nil
+}
+
+// Detokenize gives CreditCard without cvv, it must never leave the service.
+func (v *Vault) Detokenize(t domain.CardToken) (domain.CreditCard, error) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	r, ok := v.records[t]
+	if !ok {
+		return domain.CreditCard{}, errVaultTokenNotFound
+	}
+
+	b, err := v.open(t, r)
+	if err != nil {
+		return domain.CreditCard{}, err
+	}
+
+	var j jsonVaultCard
+	if err = json.Unmarshal(b, &j); err != nil {
+		return domain.CreditCard{}, err
+	}
+
+	return domain.NewCardOnFile(j.Owner, j.Number, j.Expire)
+}
+
+// Fingerprint of CreditCard behind CardToken.
+func (v *Vault) Fingerprint(t domain.CardToken) (string, error) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	r, ok := v.records[t]
+	if !ok {
+		return "", errVaultTokenNotFound
+	}
+
+	return r.fingerprint, nil
+}
+
+func (v *Vault) Delete(t domain.CardToken) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	r, ok := v.records[t]
+	if !ok {
+		return errVaultTokenNotFound
+	}
+
+	delete(v.records, t)
+	delete(v.tokens, r.fingerprint)
+	if err := v.save(); err != nil {
+		v.records[t], v.tokens[r.fingerprint] = r, t
+		return err
+	}
+
+	return nil
+}
+
+// Rotate introduces new random data key and reseals all stored records with
+// it, retired keys are discarded when no record is sealed with them.
+func (v *Vault) Rotate() error {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	n := v.version + 1
+	k, err := v.wrap(n, b)
+	if err != nil {
+		return err
+	}
+
+	keys := map[int]vaultKey{n: k}
+	records := make(map[domain.CardToken]record, len(v.records))
+	for t, r := range v.records {
+		b, err := v.open(t, r)
+		if err != nil {
+			return err
+		}
+
+		x, err := seal(k, n, t, b)
+		if err != nil {
+			return err
+		}
+
+		x.fingerprint = r.fingerprint
+		records[t] = x
+	}
+
+	pk, pr, pv := v.keys, v.records, v.version
+	v.keys, v.records, v.version = keys, records, n
+	if err = v.save(); err != nil {
+		v.keys, v.records, v.version = pk, pr, pv
+		return err
+	}
+
+	vlog("INF key rotated to #%d, %d records resealed", v.version, len(records))
+	return nil
+}
+
+func (v *Vault) save() error {
+	if v.path == "" {
+		return nil
+	}
+
+	j := jsonVault{Version: v.version}
+	for n, k := range v.keys {
+		j.Keys = append(j.Keys, jsonVaultKey{n, k.nonce, k.data})
+	}
+
+	for t, r := range v.records {
+		j.Records = append(j.Records, jsonVaultRecord{t, r.version, r.nonce, r.data, r.fingerprint})
+	}
+
+	return replaceJSON(v.path, j)
+}
+
+// wrap data key of version with master key, so it can be kept along with
+// records, sealed key is bound to its version.
+func (v *Vault) wrap(version int, b []byte) (vaultKey, error) {
+	a, err := newVaultCipher(b)
+	if err != nil {
+		return vaultKey{}, err
+	}
+
+	n := make([]byte, v.master.NonceSize())
+	if _, err = rand.Read(n); err != nil {
+		return vaultKey{}, err
+	}
+
+	return vaultKey{a, n, v.master.Seal(nil, n, b, []byte(strconv.Itoa(version)))}, nil
+}
+
+func (v *Vault) unwrap(j jsonVaultKey) (vaultKey, error) {
+	b, err := v.master.Open(nil, j.Nonce, j.Data, []byte(strconv.Itoa(j.Version)))
+	if err != nil {
+		return vaultKey{}, errVaultKeyMismatch
+	}
+
+	a, err := newVaultCipher(b)
+	if err != nil {
+		return vaultKey{}, err
+	}
+
+	return vaultKey{a, j.Nonce, j.Data}, nil
+}
+
+// seal binds ciphertext with CardToken, so record can not be swapped.
+func (v *Vault) seal(t domain.CardToken, b []byte) (record, error) {
+	return seal(v.keys[v.version], v.version, t, b)
+}
+
+// open record with key of its version, retired keys are kept until records
+// sealed with them are resealed.
+func (v *Vault) open(t domain.CardToken, r record) ([]byte, error) {
+	k, ok := v.keys[r.version]
+	if !ok {
+		return nil, errVaultKeyRetired
+	}
+
+	return k.Open(nil, r.nonce, r.data, []byte(t))
+}
+
+func seal(k vaultKey, version int, t domain.CardToken, b []byte) (record, error) {
+	n := make([]byte, k.NonceSize())
+	if _, err := rand.Read(n); err != nil {
+		return record{}, err
+	}
+
+	return record{
+		version: version,
+		nonce:   n,
+		data:    k.Seal(nil, n, b, []byte(t)),
+	}, nil
+}
+
+func newVaultCipher(key []byte) (cipher.AEAD, error) {
+	if key == nil {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(key) != 32 {
+		return nil, errVaultKey
+	}
+
+	b, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(b)
+}
+
+// vaultKey is data key of keyring, nonce and data tell it sealed with master key.
+type vaultKey struct {
+	cipher.AEAD
+	nonce, data []byte
+}
+
+type record struct {
+	version     int
+	nonce, data []byte
+	fingerprint string
+}
+
+// jsonVault is keyring and records as kept in file, data keys are sealed with
+// master key.
+type jsonVault struct {
+	Version int
+	Keys    []jsonVaultKey
+	Records []jsonVaultRecord
+}
+
+type jsonVaultKey struct {
+	Version     int
+	Nonce, Data []byte
+}
+
+type jsonVaultRecord struct {
+	Token       domain.CardToken
+	Version     int
+	Nonce, Data []byte
+	Fingerprint string
+}
+
+type jsonVaultCard struct {
+	Owner, Number, Expire string
+}
+
+var (
+	errVaultCard          = domain.NewError(domain.Validation, "invalid_card", "vault: invalid card")
+	errVaultKey           = domain.Err("vault: invalid key, expected 32 bytes")
+	errVaultKeyRandom     = domain.Err("vault: random key is not possible with records kept in file")
+	errVaultKeyMismatch   = domain.Err("vault: master key does not open keyring kept in file")
+	errVaultKeyRetired    = domain.Err("vault: record sealed with retired key")
+	errVaultTokenNotFound = domain.NewError(domain.NotFound, "card_token_not_found", "vault: token not found")
+)
+
+var vlog = DefaultLogger.Tag("Vault").Print
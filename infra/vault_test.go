@@ -0,0 +1,153 @@
+package infra
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"payment/domain"
+)
+
+func TestVault(t *testing.T) {
+	v, err := NewVault(nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := domain.NewCreditCard("Tom", "4000000000000044", "04/2099", "884")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := v.Tokenize(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b, _ := v.Tokenize(c); a != b {
+		t.Fatalf("expected same token for same card got:%s %s", a, b)
+	}
+
+	if err = v.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := v.Detokenize(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d.Number() != c.Number() || d.HasCVV() || d.Card() != c.Card() {
+		t.Fatalf("expected:%v without cvv got:%v", c, d)
+	}
+
+	if f, _ := v.Fingerprint(a); f != c.Card().Fingerprint() {
+		t.Fatalf("expected:%s got:%s", c.Card().Fingerprint(), f)
+	}
+
+	if err = v.Delete(a); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = v.Detokenize(a); err != errVaultTokenNotFound {
+		t.Fatalf("expected:%v got:%v", errVaultTokenNotFound, err)
+	}
+}
+
+func TestVault_File(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "vault.json")
+	k := bytes.Repeat([]byte{1}, 32)
+	if _, err := NewVault(nil, p); err != errVaultKeyRandom {
+		t.Fatalf("expected:%v got:%v", errVaultKeyRandom, err)
+	}
+
+	v, err := NewVault(k, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := domain.NewCreditCard("Tom", "4000000000000044", "04/2099", "884")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := v.Tokenize(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// data key of vault kept in file is rotated as well
+	if err = v.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+
+	// restart
+	if _, err = NewVault(bytes.Repeat([]byte{2}, 32), p); err != errVaultKeyMismatch {
+		t.Fatalf("expected:%v got:%v", errVaultKeyMismatch, err)
+	}
+
+	if v, err = NewVault(k, p); err != nil {
+		t.Fatal(err)
+	}
+
+	if d, err := v.Detokenize(a); err != nil || d.Number() != c.Number() || v.records[a].version != 2 {
+		t.Fatalf("expected:%v with key #2 got:%v %v", c, d, err)
+	}
+
+	if b, _ := v.Tokenize(c); a != b {
+		t.Fatalf("expected same token for same card got:%s %s", a, b)
+	}
+
+	if err = v.Delete(a); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, err = NewVault(k, p); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = v.Detokenize(a); err != errVaultTokenNotFound {
+		t.Fatalf("expected:%v got:%v", errVaultTokenNotFound, err)
+	}
+}
+
+func TestVault_Retired(t *testing.T) {
+	v, err := NewVault(nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := domain.NewCreditCard("Tom", "4000000000000044", "04/2099", "884")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := v.Tokenize(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	k, r := v.keys[1], v.records[a]
+	if err = v.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+
+	// record not resealed yet is opened with retired key
+	v.keys[1], v.records[a] = k, r
+	if d, err := v.Detokenize(a); err != nil || d.Number() != c.Number() {
+		t.Fatalf("expected:%v got:%v %v", c, d, err)
+	}
+
+	// retired key without records is discarded
+	if err = v.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := v.keys[1]; ok || len(v.keys) != 1 || v.records[a].version != 3 {
+		t.Fatalf("expected key #3 only got:%v %v", len(v.keys), v.records[a].version)
+	}
+
+	if d, err := v.Detokenize(a); err != nil || d.Number() != c.Number() {
+		t.Fatalf("expected:%v got:%v %v", c, d, err)
+	}
+}
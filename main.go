@@ -1,11 +1,45 @@
 package main
 
 import (
+	"flag"
 	"log"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
 )
 
 func main() {
-	if err := NewService().Run(); err != nil {
+	var c Config
+	var b string
+	flag.StringVar(&c.Rates, "rates", "", "path to JSON file with foreign exchange rates")
+	flag.StringVar(&c.Rounding, "rounding", "half-up", "rounding of currency conversions: half-up, half-even, up, down")
+	flag.StringVar(&b, "brands", "", "comma separated card brands accepted by merchants, all when empty")
+	flag.StringVar(&c.VaultKey, "vault-key", "", "hex encoded 32 bytes AES master key of cards vault, random when empty, required when vault is kept in file")
+	flag.StringVar(&c.Vault, "vault", "", "path to file of cards vault, in directory of durable event log when empty, required with database events")
+	flag.DurationVar(&c.KeyRotation, "key-rotation", 0, "how often data key of cards vault is rotated, never when zero")
+	flag.StringVar(&c.FingerprintKey, "fingerprint-key", "", "hex encoded secret of card fingerprints, at least 32 bytes, required with durable events")
+	flag.StringVar(&c.Simulator, "simulator", "", "path to JSON file with card network scenarios")
+	flag.DurationVar(&c.AuthorizationTTL, "authorization-ttl", 0, "how long authorizations are held, card brand default when zero")
+	flag.StringVar(&c.Schedule, "schedule", "", "path to file with authorization expiry schedule, kept with events when empty")
+	flag.StringVar(&c.Events, "events", "", "path to directory of durable event log or data source name of database, in memory when empty")
+	flag.StringVar(&c.EventsDriver, "events-driver", "", "database driver of event store ie sqlite3, directory of durable event log when empty")
+	flag.StringVar(&c.EventsFormat, "events-format", "json", "format in which events are written: json or gob")
+	flag.IntVar(&c.Snapshots, "snapshots", 100, "after how many events of transaction its snapshot is taken, never when zero")
+	flag.StringVar(&c.Fsync, "fsync", "always", "when events are flushed to disk: always, never or interval ie 100ms")
+	flag.DurationVar(&c.IdempotencyTTL, "idempotency-ttl", 24*time.Hour, "how long responses of requests with Idempotency-Key are kept")
+	flag.Parse()
+
+	if b != "" {
+		c.Brands = strings.Split(b, ",")
+	}
+
+	s, err := NewService(c)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := s.Run(); err != nil {
 		log.Fatal(err)
 	}
 }
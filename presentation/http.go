@@ -1,9 +1,15 @@
 package presentation
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 	"payment/app"
@@ -12,11 +18,116 @@ import (
 )
 
 type HTTP struct {
-	payments app.Payments
+	payments    app.Payments
+	idempotency app.Idempotency
+	settings    Settings
 }
 
-func NewHTTP(p app.Payments) *HTTP {
-	return &HTTP{p}
+func NewHTTP(p app.Payments, i app.Idempotency, s Settings) *HTTP {
+	return &HTTP{p, i, s}
+}
+
+// Idempotent handles request with Idempotency-Key header only once, retries are
+// answered with response of the first request. The same key used for another
+// request is rejected, requests without key are always handled.
+func (h *HTTP) Idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		k := strings.TrimSpace(r.Header.Get("Idempotency-Key"))
+		if k == "" {
+			next(w, r)
+			return
+		}
+
+		if len(k) > 255 {
+			h.failed(r, w, errIdempotencyKey)
+			return
+		}
+
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			h.failed(r, w, err)
+			return
+		}
+
+		r.Body.Close()
+		r.Body = io.NopCloser(bytes.NewReader(b))
+
+		s := sha256.New()
+		s.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+		s.Write(b)
+		hash := hex.EncodeToString(s.Sum(nil))
+
+		x, ok, err := h.idempotency.Reserve(k, hash)
+		switch {
+		case err != nil:
+			h.failed(r, w, err)
+		case ok && x.Hash != hash:
+			h.failed(r, w, errIdempotencyKeyReused)
+		case ok && x.Status == 0:
+			h.failed(r, w, errIdempotencyInProgress)
+		case ok:
+			w.Header().Set("Idempotent-Replayed", "true")
+			if len(x.Body) != 0 {
+				w.Header().Set("Content-Type", "application/json")
+			}
+
+			w.WriteHeader(x.Status)
+			w.Write(x.Body)
+		default:
+			h.record(k, hash, next, w, r)
+		}
+	}
+}
+
+// record response of request under idempotency key, key of internal failure
+// or panic of handler is released, so request can be retried.
+func (h *HTTP) record(key, hash string, next http.HandlerFunc, w http.ResponseWriter, r *http.Request) {
+	c := &recorder{ResponseWriter: w, status: http.StatusOK}
+	completed := false
+	defer func() {
+		var err error
+		if !completed || c.status >= http.StatusInternalServerError {
+			err = h.idempotency.Release(key)
+		} else {
+			err = h.idempotency.Save(key, app.Result{Hash: hash, Status: c.status, Body: c.body.Bytes()})
+		}
+
+		if err != nil {
+			log("ERR %s:%s idempotency key %s failed due %s", r.Method, r.URL.String(), key, err)
+		}
+	}()
+
+	next(c, r)
+	completed = true
+}
+
+// Get Transaction of given ID.
+func (h *HTTP) Get(w http.ResponseWriter, r *http.Request) {
+	m, err := h.payment(r).Get()
+	if err != nil {
+		h.failed(r, w, err)
+		return
+	}
+
+	h.encode(w, newResponse(m))
+}
+
+// Find Transaction of merchant reference given in query, ie
+// GET /transactions?reference=order-1234
+func (h *HTTP) Find(w http.ResponseWriter, r *http.Request) {
+	p, err := h.payments.Find(r.URL.Query().Get("reference"), newMerchant(r, h.settings))
+	if err != nil {
+		h.failed(r, w, err)
+		return
+	}
+
+	m, err := p.Get()
+	if err != nil {
+		h.failed(r, w, err)
+		return
+	}
+
+	h.encode(w, newResponse(m))
 }
 
 func (h *HTTP) Authorize(w http.ResponseWriter, r *http.Request) {
@@ -26,14 +137,90 @@ func (h *HTTP) Authorize(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	o, err := req.order()
+	if err != nil {
+		h.failed(r, w, err)
+		return
+	}
+
+	var m app.Response
+	var p = h.payment(r)
+	if req.CardToken != "" {
+		m, err = p.AuthorizeToken(req.CardToken, req.Money, req.Settlement, o)
+	} else {
+		m, err = p.Authorize(req.CreditCard, req.Money, req.Settlement, o)
+	}
+
+	if err != nil {
+		h.declined(r, w, m, err)
+		return
+	}
+
+	h.encode(w, newResponse(m))
+}
+
+// Sale authorizes and captures in one request, ie for digital goods.
+func (h *HTTP) Sale(w http.ResponseWriter, r *http.Request) {
+	var req request
+	if err := h.decode(r, &req); err != nil {
+		h.failed(r, w, err)
+		return
+	}
+
+	o, err := req.order()
+	if err != nil {
+		h.failed(r, w, err)
+		return
+	}
+
+	var m app.Response
+	var p = h.payment(r)
+	if req.CardToken != "" {
+		m, err = p.SaleToken(req.CardToken, req.Money, req.Settlement, o)
+	} else {
+		m, err = p.Sale(req.CreditCard, req.Money, req.Settlement, o)
+	}
+
+	if err != nil {
+		h.declined(r, w, m, err)
+		return
+	}
+
+	h.encode(w, newResponse(m))
+}
+
+func (h *HTTP) Verify(w http.ResponseWriter, r *http.Request) {
+	var req verification
+	if err := h.decode(r, &req); err != nil {
+		h.failed(r, w, err)
+		return
+	}
+
+	p := h.payment(r)
+	m, err := p.Verify(req.CreditCard, req.Currency, req.Address)
+	if err != nil {
+		h.declined(r, w, m, err)
+		return
+	}
+
+	h.encode(w, newResponse(m))
+}
+
+func (h *HTTP) Increment(w http.ResponseWriter, r *http.Request) {
+	var req domain.Money
+	if err := h.decode(r, &req); err != nil {
+		h.failed(r, w, err)
+		return
+	}
+
 	p := h.payment(r)
-	m, err := p.Authorize(req.CreditCard, req.Money)
+	m, err := p.IncrementAuthorization(req)
 	if err != nil {
 		h.failed(r, w, err)
 		return
 	}
 
-	h.encode(w, response{p.ID(), m})
+	h.encode(w, newResponse(m))
 }
 
 func (h *HTTP) Void(w http.ResponseWriter, r *http.Request) {
@@ -44,10 +231,27 @@ func (h *HTTP) Void(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	h.encode(w, response{p.ID(), m})
+	h.encode(w, newResponse(m))
 }
 
 func (h *HTTP) Capture(w http.ResponseWriter, r *http.Request) {
+	var req capture
+	if err := h.decode(r, &req); err != nil {
+		h.failed(r, w, err)
+		return
+	}
+
+	p := h.payment(r)
+	m, err := p.Capture(req.Money, req.Final)
+	if err != nil {
+		h.failed(r, w, err)
+		return
+	}
+
+	h.encode(w, newResponse(m))
+}
+
+func (h *HTTP) Reverse(w http.ResponseWriter, r *http.Request) {
 	var req domain.Money
 	if err := h.decode(r, &req); err != nil {
 		h.failed(r, w, err)
@@ -55,34 +259,69 @@ func (h *HTTP) Capture(w http.ResponseWriter, r *http.Request) {
 	}
 
 	p := h.payment(r)
-	m, err := p.Capture(req)
+	m, err := p.Reverse(req)
 	if err != nil {
 		h.failed(r, w, err)
 		return
 	}
 
-	h.encode(w, response{p.ID(), m})
+	h.encode(w, newResponse(m))
 }
 
 func (h *HTTP) Refund(w http.ResponseWriter, r *http.Request) {
-	var req domain.Money
+	var req refund
 	if err := h.decode(r, &req); err != nil {
 		h.failed(r, w, err)
 		return
 	}
 
 	p := h.payment(r)
-	m, err := p.Refund(req)
+	m, err := p.Refund(req.Capture, req.Money)
+	if err != nil {
+		h.failed(r, w, err)
+		return
+	}
+
+	h.encode(w, newResponse(m))
+}
+
+func (h *HTTP) Tokenize(w http.ResponseWriter, r *http.Request) {
+	var req domain.CreditCard
+	if err := h.decode(r, &req); err != nil {
+		h.failed(r, w, err)
+		return
+	}
+
+	t, c, err := h.wallet(r).Tokenize(req)
 	if err != nil {
 		h.failed(r, w, err)
 		return
 	}
 
-	h.encode(w, response{p.ID(), m})
+	h.encode(w, token{t, c})
+}
+
+func (h *HTTP) Detach(w http.ResponseWriter, r *http.Request) {
+	t, err := domain.NewCardToken(mux.Vars(r)["token"])
+	if err != nil {
+		h.failed(r, w, err)
+		return
+	}
+
+	if err = h.wallet(r).Delete(t); err != nil {
+		h.failed(r, w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *HTTP) wallet(r *http.Request) *app.Wallet {
+	return h.payments.Wallet(newMerchant(r, h.settings))
 }
 
 func (h *HTTP) payment(r *http.Request) *app.Payment {
-	return h.payments.Read(h.id(r), newMerchant(r))
+	return h.payments.Read(h.id(r), newMerchant(r, h.settings))
 }
 
 func (h *HTTP) id(r *http.Request) domain.ID {
@@ -91,8 +330,13 @@ func (h *HTTP) id(r *http.Request) domain.ID {
 
 func (h *HTTP) decode(r *http.Request, d document) error {
 	defer r.Body.Close()
-	if err := json.NewDecoder(r.Body).Decode(d); err != nil && err != io.EOF {
-		return err
+	err := json.NewDecoder(r.Body).Decode(d)
+	if err != nil && err != io.EOF {
+		if errors.As(err, new(*domain.Error)) {
+			return err
+		}
+
+		return domain.NewError(domain.Validation, "invalid_request", "request: %s", err)
 	}
 
 	return nil
@@ -102,31 +346,238 @@ func (h *HTTP) encode(w http.ResponseWriter, d document) {
 	json.NewEncoder(w).Encode(d)
 }
 
+// failed responds with JSON document of domain.Error, errors outside of catalog
+// are reported as internal.
 func (h *HTTP) failed(r *http.Request, w http.ResponseWriter, err error) {
-	http.Error(w, err.Error(), http.StatusBadRequest)
+	h.declined(r, w, app.Response{}, err)
+}
+
+// declined responds as failed, Transaction which recorded decline is given too,
+// so it can be read later.
+func (h *HTTP) declined(r *http.Request, w http.ResponseWriter, m app.Response, err error) {
+	var e *domain.Error
+	var s = http.StatusInternalServerError
+	var d = failure{Error: errInternal, Transaction: m.Transaction}
+	if errors.As(err, &e) {
+		s, d.Error = statuses[e.Class], &domain.Error{
+			Code:     e.Code,
+			Class:    e.Class,
+			Response: e.Response,
+			Message:  err.Error(),
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(s)
+	h.encode(w, d)
 	log("ERR %s:%s failed due %s", r.Method, r.URL.String(), err)
 }
 
 type request struct {
 	CreditCard domain.CreditCard
+	CardToken  domain.CardToken
 	Money      domain.Money
+	Settlement string
+
+	MerchantReference   string
+	Metadata            map[string]string
+	StatementDescriptor string
+}
+
+// UnmarshalJSON accepts merchant_reference and statement_descriptor spellings
+// of order fields as well.
+func (r *request) UnmarshalJSON(b []byte) error {
+	type plain request
+	var d struct {
+		plain
+		Reference  string `json:"merchant_reference"`
+		Descriptor string `json:"statement_descriptor"`
+	}
+
+	if err := json.Unmarshal(b, &d); err != nil {
+		return err
+	}
+
+	*r = request(d.plain)
+	if r.MerchantReference == "" {
+		r.MerchantReference = d.Reference
+	}
+
+	if r.StatementDescriptor == "" {
+		r.StatementDescriptor = d.Descriptor
+	}
+
+	return nil
+}
+
+func (r request) order() (domain.Order, error) {
+	return domain.NewOrder(r.MerchantReference, r.Metadata, r.StatementDescriptor)
+}
+
+type verification struct {
+	CreditCard domain.CreditCard
+	Currency   string
+	Address    domain.Address
+}
+
+// capture is Money document with Final flag, ie
+// {"Amount": "10.00", "Currency": "USD", "Final": true}
+type capture struct {
+	domain.Money
+	Final bool
+}
+
+func (c *capture) UnmarshalJSON(b []byte) error {
+	var f struct{ Final bool }
+	if err := json.Unmarshal(b, &f); err != nil {
+		return err
+	}
+
+	c.Final = f.Final
+	return json.Unmarshal(b, &c.Money)
+}
+
+// refund is Money document with ID of refunded capture, ie
+// {"Amount": "10.00", "Currency": "USD", "Capture": "V1StGXR8_Z5jdHi6B-myT.c1"}
+type refund struct {
+	domain.Money
+	Capture domain.ID
+}
+
+func (r *refund) UnmarshalJSON(b []byte) error {
+	var f struct{ Capture domain.ID }
+	if err := json.Unmarshal(b, &f); err != nil {
+		return err
+	}
+
+	r.Capture = f.Capture
+	return json.Unmarshal(b, &r.Money)
 }
 
 type response struct {
 	ID        domain.ID
+	Status    domain.Status
+	Card      *domain.Card `json:",omitempty"`
 	Available domain.Money
+	Captured  domain.Money
+	Refunded  domain.Money
+	Released  domain.Money
+	Captures  []domain.Capture
+	Refunds   []domain.Refund
+
+	MerchantReference   string            `json:",omitempty"`
+	Metadata            map[string]string `json:",omitempty"`
+	StatementDescriptor string            `json:",omitempty"`
+
+	Verification *domain.Verification `json:",omitempty"`
+}
+
+func newResponse(r app.Response) response {
+	d := response{
+		ID:        r.Transaction,
+		Status:    r.Status,
+		Available: r.Available,
+		Captured:  r.Captured,
+		Refunded:  r.Refunded,
+		Released:  r.Released,
+		Captures:  r.Captures,
+		Refunds:   r.Refunds,
+
+		MerchantReference:   r.Order.Reference,
+		Metadata:            r.Order.Metadata,
+		StatementDescriptor: r.Order.Descriptor,
+	}
+
+	if !r.Card.IsZero() {
+		d.Card = &r.Card
+	}
+
+	if !r.Verification.IsZero() {
+		d.Verification = &r.Verification
+	}
+
+	return d
+}
+
+type token struct {
+	Token domain.CardToken
+	Card  domain.Card
+}
+
+type failure struct {
+	Error       *domain.Error
+	Transaction domain.ID `json:",omitempty"`
 }
 
 type document = interface{}
 
-type merchant struct{}
+// recorder is http.ResponseWriter which keeps copy of response.
+type recorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *recorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// Settings of merchants, the same for all of them until merchant accounts are
+// introduced.
+type Settings struct {
+	// Brands of cards accepted by merchants, any when empty.
+	Brands domain.Brands
+	// AuthorizationTTL overrides domain.Brand Hold when not zero.
+	AuthorizationTTL time.Duration
+}
+
+type merchant struct {
+	Settings
+}
+
+func newMerchant(r *http.Request, s Settings) *merchant {
+	return &merchant{s}
+}
 
-func newMerchant(r *http.Request) *merchant {
-	return &merchant{}
+// ID of merchant, the only one until merchant accounts are introduced.
+func (m *merchant) ID() string {
+	return "default"
 }
 
 func (m *merchant) IsAuthenticated() bool {
 	return true
 }
 
+func (m *merchant) Accepts(b domain.Brand) bool {
+	return len(m.Brands) == 0 || m.Brands.Has(b)
+}
+
+func (m *merchant) AuthorizationTTL(domain.Brand) time.Duration {
+	return m.Settings.AuthorizationTTL
+}
+
+var statuses = map[domain.Class]int{
+	domain.HardDecline: http.StatusPaymentRequired,
+	domain.SoftDecline: http.StatusPaymentRequired,
+	domain.Validation:  http.StatusBadRequest,
+	domain.Conflict:    http.StatusConflict,
+	domain.NotFound:    http.StatusNotFound,
+	domain.Forbidden:   http.StatusForbidden,
+
+	domain.Unprocessable: http.StatusUnprocessableEntity,
+}
+
+var (
+	errInternal              = &domain.Error{Code: "internal_error", Message: "internal error"}
+	errIdempotencyKey        = domain.NewError(domain.Validation, "invalid_idempotency_key", "request: idempotency key longer than 255 characters")
+	errIdempotencyKeyReused  = domain.NewError(domain.Unprocessable, "idempotency_key_reused", "request: idempotency key used for another request")
+	errIdempotencyInProgress = domain.NewError(domain.Conflict, "idempotency_key_in_progress", "request: request of idempotency key in progress")
+)
+
 var log = infra.DefaultLogger.Tag("HTTP").Print
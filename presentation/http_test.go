@@ -0,0 +1,245 @@
+package presentation
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"payment/app"
+	"payment/domain"
+	"payment/infra"
+)
+
+func TestHTTP_Idempotent(t *testing.T) {
+	h := newTestHTTP(t)
+	s := newTestRouter(h)
+	a := `{"CreditCard":{"Owner":"Tom","Number":"4000000000000044","Expire":"12/2099","CVV":"884"},"Money":{"Amount":"10","Currency":"USD"}}`
+
+	w := serve(s, "POST", "/transactions/authorize", "k1", a)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected:%v got:%v %s", http.StatusOK, w.Code, w.Body)
+	}
+
+	// retry is answered with the first response
+	r := serve(s, "POST", "/transactions/authorize", "k1", a)
+	if r.Code != http.StatusOK || r.Header().Get("Idempotent-Replayed") != "true" || r.Body.String() != w.Body.String() {
+		t.Fatalf("expected:%s got:%v %s", w.Body, r.Code, r.Body)
+	}
+
+	// the same key of another request is rejected
+	if r = serve(s, "POST", "/transactions/authorize", "k1", strings.Replace(a, `"10"`, `"20"`, 1)); r.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected:%v got:%v %s", http.StatusUnprocessableEntity, r.Code, r.Body)
+	}
+
+	// key of request in progress is rejected
+	started, done := make(chan struct{}), make(chan struct{})
+	slow := h.Idempotent(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-done
+	})
+
+	go serve(slow, "POST", "/slow", "k2", "")
+	<-started
+	if r = serve(slow, "POST", "/slow", "k2", ""); r.Code != http.StatusConflict {
+		t.Fatalf("expected:%v got:%v %s", http.StatusConflict, r.Code, r.Body)
+	}
+	close(done)
+
+	// key of internal failure or panic is released, so request is retried
+	for _, c := range []struct {
+		case_ string
+		have  http.HandlerFunc
+	}{
+		{"failure", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusInternalServerError) }},
+		{"panic", func(w http.ResponseWriter, r *http.Request) { panic("handler failed") }},
+	} {
+		func() {
+			defer func() { recover() }()
+			serve(h.Idempotent(c.have), "POST", "/failing", c.case_, "")
+		}()
+
+		if r = serve(h.Idempotent(func(http.ResponseWriter, *http.Request) {}), "POST", "/failing", c.case_, ""); r.Code != http.StatusOK || r.Header().Get("Idempotent-Replayed") != "" {
+			t.Fatalf("%s expected:%v got:%v %s", c.case_, http.StatusOK, r.Code, r.Body)
+		}
+	}
+}
+
+func TestHTTP_MerchantReference(t *testing.T) {
+	s := newTestRouter(newTestHTTP(t))
+	for _, c := range []struct {
+		case_ string
+		have  string
+	}{
+		{"snake case", `"merchant_reference":"order-1","statement_descriptor":"ACME SHOP"`},
+		{"camel case", `"MerchantReference":"order-2","StatementDescriptor":"ACME SHOP"`},
+	} {
+		a := `{"CreditCard":{"Owner":"Tom","Number":"4000000000000044","Expire":"12/2099","CVV":"884"},"Money":{"Amount":"10","Currency":"USD"},` + c.have + `}`
+		w := serve(s, "POST", "/transactions/authorize", "", a)
+		var d response
+		if err := json.NewDecoder(w.Body).Decode(&d); err != nil {
+			t.Fatal(err)
+		}
+
+		if w.Code != http.StatusOK || d.MerchantReference == "" || d.StatementDescriptor != "ACME SHOP" {
+			t.Fatalf("%s expected:%v got:%v %+v", c.case_, http.StatusOK, w.Code, d)
+		}
+
+		// transaction is found by reference
+		w = serve(s, "GET", "/transactions?reference="+d.MerchantReference, "", "")
+		var f response
+		if err := json.NewDecoder(w.Body).Decode(&f); err != nil {
+			t.Fatal(err)
+		}
+
+		if w.Code != http.StatusOK || f.ID != d.ID {
+			t.Fatalf("%s expected:%v got:%v %+v", c.case_, d.ID, w.Code, f)
+		}
+
+		// reference is unique per merchant
+		if w = serve(s, "POST", "/transactions/authorize", "", a); w.Code != http.StatusConflict {
+			t.Fatalf("%s expected:%v got:%v %s", c.case_, http.StatusConflict, w.Code, w.Body)
+		}
+	}
+}
+
+func TestHTTP_Settlement(t *testing.T) {
+	s := newTestRouter(newTestHTTP(t))
+	for _, c := range []struct {
+		case_ string
+		have  string
+		want  int
+	}{
+		{"upper case", `"USD"`, http.StatusOK},
+		{"lower case", `"usd"`, http.StatusOK},
+		{"padded", `" usd "`, http.StatusOK},
+		{"unknown", `"XXX"`, http.StatusBadRequest},
+	} {
+		a := `{"CreditCard":{"Owner":"Tom","Number":"4000000000000044","Expire":"12/2099","CVV":"884"},"Money":{"Amount":"10","Currency":"USD"},"Settlement":` + c.have + `}`
+		if w := serve(s, "POST", "/transactions/authorize", "", a); w.Code != c.want {
+			t.Fatalf("%s expected:%v got:%v %s", c.case_, c.want, w.Code, w.Body)
+		}
+	}
+}
+
+func TestHTTP_SaleHoldPending(t *testing.T) {
+	// test card declined on capture, reversal fails as well
+	s := newTestRouter(newTestHTTP(t, infra.Scenario{Operation: "reverse", PAN: "4000000000000259", Decline: "91"}))
+	a := `{"CreditCard":{"Owner":"Tom","Number":"4000000000000259","Expire":"12/2099","CVV":"884"},"Money":{"Amount":"10","Currency":"USD"},"MerchantReference":"order-1"}`
+
+	w := serve(s, "POST", "/transactions/sale", "", a)
+	var f failure
+	if err := json.NewDecoder(w.Body).Decode(&f); err != nil {
+		t.Fatal(err)
+	}
+
+	if w.Code != http.StatusConflict || f.Transaction == "" || f.Error == nil || f.Error.Code != "hold_pending_release" {
+		t.Fatalf("expected:%v hold_pending_release got:%v %+v", http.StatusConflict, w.Code, f)
+	}
+
+	// held authorization keeps its reference
+	w = serve(s, "GET", "/transactions?reference=order-1", "", "")
+	var d response
+	if err := json.NewDecoder(w.Body).Decode(&d); err != nil {
+		t.Fatal(err)
+	}
+
+	if w.Code != http.StatusOK || d.ID != f.Transaction || d.Status != domain.Authorized {
+		t.Fatalf("expected:%v got:%v %+v", domain.Authorized, w.Code, d)
+	}
+
+	if w = serve(s, "POST", "/transactions/sale", "", a); w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), "merchant_reference_taken") {
+		t.Fatalf("expected:%v merchant_reference_taken got:%v %s", http.StatusConflict, w.Code, w.Body)
+	}
+}
+
+func TestHTTP_Declined(t *testing.T) {
+	s := newTestRouter(newTestHTTP(t))
+
+	// test card declined on authorization
+	w := serve(s, "POST", "/transactions/authorize", "", `{"CreditCard":{"Owner":"Tom","Number":"4000000000000119","Expire":"12/2099","CVV":"884"},"Money":{"Amount":"10","Currency":"USD"}}`)
+	var f failure
+	if err := json.NewDecoder(w.Body).Decode(&f); err != nil {
+		t.Fatal(err)
+	}
+
+	if w.Code != http.StatusPaymentRequired || f.Transaction == "" || f.Error == nil || f.Error.Class != domain.HardDecline {
+		t.Fatalf("expected:%v with transaction got:%v %+v", http.StatusPaymentRequired, w.Code, f)
+	}
+
+	w = serve(s, "GET", "/transactions/"+string(f.Transaction), "", "")
+	var d response
+	if err := json.NewDecoder(w.Body).Decode(&d); err != nil {
+		t.Fatal(err)
+	}
+
+	if w.Code != http.StatusOK || d.ID != f.Transaction || d.Status != domain.Declined {
+		t.Fatalf("expected:%v got:%v %+v", domain.Declined, w.Code, d)
+	}
+}
+
+// newTestHTTP with simulator of given scenarios before default ones.
+func newTestHTTP(t *testing.T, scenarios ...infra.Scenario) *HTTP {
+	p, err := infra.NewSimulator(1, append(scenarios, infra.DefaultScenarios...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := infra.NewSchedule("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := infra.NewReferences("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewHTTP(testPayments{app.Resources{
+		Transactions: infra.NewTransactions(infra.NewEvents()),
+		Rates:        infra.NewRates(),
+		Processor:    p,
+		Schedule:     s,
+		References:   f,
+		Locks:        infra.NewLocks(),
+	}}, infra.NewIdempotency(time.Hour), Settings{})
+}
+
+func newTestRouter(h *HTTP) *mux.Router {
+	r := mux.NewRouter()
+	r.HandleFunc("/transactions", h.Find).Methods("GET").Queries("reference", "{reference}")
+	r.HandleFunc("/transactions/{id}", h.Get).Methods("GET")
+	r.HandleFunc("/transactions/authorize", h.Idempotent(h.Authorize)).Methods("POST")
+	r.HandleFunc("/transactions/sale", h.Idempotent(h.Sale)).Methods("POST")
+	return r
+}
+
+func serve(h http.Handler, method, path, key, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if key != "" {
+		r.Header.Set("Idempotency-Key", key)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+type testPayments struct {
+	resources app.Resources
+}
+
+func (p testPayments) Read(id domain.ID, m app.Merchant) *app.Payment {
+	return app.NewPayment(id, m, p.resources)
+}
+
+func (p testPayments) Find(reference string, m app.Merchant) (*app.Payment, error) {
+	return app.FindPayment(reference, m, p.resources)
+}
+
+func (p testPayments) Wallet(m app.Merchant) *app.Wallet {
+	return app.NewWallet(m, p.resources.Cards)
+}
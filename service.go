@@ -1,7 +1,10 @@
 package main
 
 import (
+	"encoding/hex"
 	"net/http"
+	"path/filepath"
+	"time"
 
 	"github.com/gorilla/mux"
 	"payment/app"
@@ -10,27 +13,280 @@ import (
 	"payment/presentation"
 )
 
+type Config struct {
+	// Rates is path to JSON file with foreign exchange rates, when empty only
+	// same currency payments are possible.
+	Rates string
+	// Rounding of currency conversions, one of half-up, half-even, up, down.
+	Rounding string
+	// Brands of cards accepted by merchants, all when empty.
+	Brands []string
+	// VaultKey is hex encoded 32 bytes AES master key of cards vault, which
+	// seals its data keys, random when empty. It is required when Vault is kept
+	// in file.
+	VaultKey string
+	// Vault is path to file of cards vault, when empty vault is kept in
+	// directory of durable event log, or in memory only when Events are. It is
+	// required when events are kept in database.
+	Vault string
+	// KeyRotation tells how often data key of cards vault is rotated, never
+	// when zero.
+	KeyRotation time.Duration
+	// FingerprintKey is hex encoded secret of card fingerprints, at least 32
+	// bytes long. It is required when Events are durable, random otherwise.
+	FingerprintKey string
+	// Simulator is path to JSON file with card network scenarios, when empty
+	// infra.DefaultScenarios are used.
+	Simulator string
+	// AuthorizationTTL tells how long authorizations are held, when zero card
+	// brand default is used.
+	AuthorizationTTL time.Duration
+	// Schedule is path to file with authorization expiry schedule, when empty
+	// schedule is kept with Events.
+	Schedule string
+	// Events is path to directory of durable event log, or data source name of
+	// database when EventsDriver is set, when empty events are kept in memory only.
+	// Checkpoints of subscribers, merchant references and expiry schedule are
+	// kept in the same place.
+	Events string
+	// Snapshots tells after how many events of Transaction its snapshot is
+	// taken, never when zero.
+	Snapshots int
+	// EventsFormat is format in which events are written, json or gob, events
+	// are read in any of them.
+	EventsFormat string
+	// EventsDriver is database/sql driver of event store, ie sqlite3 or postgres,
+	// when empty Events is directory of durable event log.
+	EventsDriver string
+	// Fsync tells when events are flushed to disk: always, never or interval
+	// ie 100ms.
+	Fsync string
+	// IdempotencyTTL tells how long responses of requests with Idempotency-Key
+	// are kept, a day when zero.
+	IdempotencyTTL time.Duration
+}
+
 type Service struct {
-	transaction app.Transactions
+	resources   app.Resources
+	vault       *infra.Vault
+	expiry      *app.Expiry
+	idempotency app.Idempotency
+	settings    presentation.Settings
+	keyRotation time.Duration
+	feed        infra.Feed
+	checkpoints infra.Checkpoints
 }
 
-func NewService() *Service {
-	return &Service{
-		transaction: infra.NewTransactions(),
+func NewService(c Config) (*Service, error) {
+	var err error
+	var s = Service{
+		resources: app.Resources{
+			Rates: infra.NewRates(),
+		},
+		idempotency: infra.NewIdempotency(c.IdempotencyTTL),
+		settings:    presentation.Settings{AuthorizationTTL: c.AuthorizationTTL},
+		keyRotation: c.KeyRotation,
+	}
+
+	// fingerprints of durable events have to stay the same after restart
+	switch {
+	case c.FingerprintKey != "":
+		k, err := hex.DecodeString(c.FingerprintKey)
+		if err != nil {
+			return nil, err
+		}
+
+		if err = domain.SetFingerprintKey(k); err != nil {
+			return nil, err
+		}
+	case c.Events != "":
+		return nil, errFingerprintKey
+	default:
+		infra.DefaultLogger.Print("INF random fingerprint key used, fingerprints change on restart")
+	}
+
+	f, err := infra.NewFormat(c.EventsFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	infra.SetEventFormat(f)
+
+	var e infra.Store = infra.NewEvents()
+	var v = c.Vault
+	s.resources.Locks = infra.NewLocks()
+	if c.EventsDriver != "" {
+		q, err := infra.OpenSQL(c.EventsDriver, c.Events)
+		if err != nil {
+			return nil, err
+		}
+
+		if v == "" {
+			return nil, errVaultPath
+		}
+
+		// commands of processes sharing database are serialized by it
+		e, s.resources.Locks, s.checkpoints = q, q, q
+		s.resources.References, s.resources.Schedule = q, q
+	} else if c.Events != "" {
+		f, err := infra.NewFsync(c.Fsync)
+		if err != nil {
+			return nil, err
+		}
+
+		if e, err = infra.OpenJournal(c.Events, f, 0); err != nil {
+			return nil, err
+		}
+
+		if s.checkpoints, err = infra.OpenCheckpoints(filepath.Join(c.Events, "checkpoints.json")); err != nil {
+			return nil, err
+		}
+
+		if s.resources.References, err = infra.NewReferences(filepath.Join(c.Events, "references.json")); err != nil {
+			return nil, err
+		}
+
+		if s.resources.Schedule, err = infra.NewSchedule(filepath.Join(c.Events, "schedule.json")); err != nil {
+			return nil, err
+		}
+
+		if v == "" {
+			v = filepath.Join(c.Events, "vault.json")
+		}
+	} else {
+		if s.checkpoints, err = infra.OpenCheckpoints(""); err != nil {
+			return nil, err
+		}
+
+		if s.resources.References, err = infra.NewReferences(""); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.Schedule != "" || s.resources.Schedule == nil {
+		if s.resources.Schedule, err = infra.NewSchedule(c.Schedule); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.Snapshots > 0 {
+		e = infra.NewSnapshots(e, c.Snapshots)
+	}
+
+	s.feed = e
+	s.resources.Transactions = infra.NewTransactions(e)
+	if c.IdempotencyTTL == 0 {
+		s.idempotency = infra.NewIdempotency(24 * time.Hour)
+	}
+
+	if c.Rates != "" {
+		if s.resources.Rates, err = infra.ReadRates(c.Rates); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.Rounding != "" {
+		if s.resources.Rounding, err = domain.NewRounding(c.Rounding); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.settings.Brands, err = domain.NewBrands(c.Brands...); err != nil {
+		return nil, err
+	}
+
+	var k []byte
+	if c.VaultKey != "" {
+		if k, err = hex.DecodeString(c.VaultKey); err != nil {
+			return nil, err
+		}
+	}
+
+	// records of vault kept in file are opened by the same key after restart
+	if v != "" && k == nil {
+		return nil, errVaultKey
+	}
+
+	if s.vault, err = infra.NewVault(k, v); err != nil {
+		return nil, err
 	}
+
+	if c.Simulator != "" {
+		s.resources.Processor, err = infra.ReadSimulator(c.Simulator)
+	} else {
+		s.resources.Processor, err = infra.NewSimulator(time.Now().UnixNano(), infra.DefaultScenarios...)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	s.resources.Cards = s.vault
+	s.expiry = app.NewExpiry(s.resources.Transactions, s.resources.Schedule, s.resources.Locks)
+	return &s, nil
 }
 
 func (s *Service) Read(id domain.ID, m app.Merchant) *app.Payment {
-	return app.NewPayment(id, m, s.transaction)
+	return app.NewPayment(id, m, s.resources)
+}
+
+func (s *Service) Find(reference string, m app.Merchant) (*app.Payment, error) {
+	return app.FindPayment(reference, m, s.resources)
+}
+
+func (s *Service) Wallet(m app.Merchant) *app.Wallet {
+	return app.NewWallet(m, s.resources.Cards)
+}
+
+// Subscribe handler to events of all transactions from checkpoint of
+// subscriber, ie for projections or webhooks.
+func (s *Service) Subscribe(subscriber string, h func(infra.Record) error) (*infra.Subscription, error) {
+	return infra.Subscribe(s.feed, s.checkpoints, subscriber, h)
 }
 
 func (s *Service) Run() error {
-	h := presentation.NewHTTP(s)
+	h := presentation.NewHTTP(s, s.idempotency, s.settings)
 	r := mux.NewRouter()
-	r.HandleFunc("/transactions/authorize", h.Authorize).Methods("POST")
-	r.HandleFunc("/transactions/{id}/void", h.Void).Methods("PUT")
-	r.HandleFunc("/transactions/{id}/capture", h.Capture).Methods("PUT")
-	r.HandleFunc("/transactions/{id}/refund", h.Refund).Methods("PUT")
+	r.HandleFunc("/transactions", h.Find).Methods("GET").Queries("reference", "{reference}")
+	r.HandleFunc("/transactions/{id}", h.Get).Methods("GET")
+	r.HandleFunc("/transactions/authorize", h.Idempotent(h.Authorize)).Methods("POST")
+	r.HandleFunc("/transactions/sale", h.Idempotent(h.Sale)).Methods("POST")
+	r.HandleFunc("/transactions/verify", h.Idempotent(h.Verify)).Methods("POST")
+	r.HandleFunc("/transactions/{id}/increment", h.Idempotent(h.Increment)).Methods("PUT")
+	r.HandleFunc("/transactions/{id}/void", h.Idempotent(h.Void)).Methods("PUT")
+	r.HandleFunc("/transactions/{id}/reverse", h.Idempotent(h.Reverse)).Methods("PUT")
+	r.HandleFunc("/transactions/{id}/capture", h.Idempotent(h.Capture)).Methods("PUT")
+	r.HandleFunc("/transactions/{id}/refund", h.Idempotent(h.Refund)).Methods("PUT")
+	r.HandleFunc("/cards", h.Idempotent(h.Tokenize)).Methods("POST")
+	r.HandleFunc("/cards/{token}", h.Idempotent(h.Detach)).Methods("DELETE")
+
+	if s.keyRotation > 0 {
+		go s.rotate()
+	}
+
+	go s.expire()
 
 	return http.ListenAndServe("", r)
 }
+
+func (s *Service) expire() {
+	for range time.Tick(time.Minute) {
+		if err := s.expiry.Release(time.Now()); err != nil {
+			infra.DefaultLogger.Print("ERR releasing expired authorizations failed due %s", err)
+		}
+	}
+}
+
+func (s *Service) rotate() {
+	for range time.Tick(s.keyRotation) {
+		if err := s.vault.Rotate(); err != nil {
+			infra.DefaultLogger.Print("ERR vault key rotation failed due %s", err)
+		}
+	}
+}
+
+var (
+	errFingerprintKey = domain.Err("fingerprint key is required when events are durable")
+	errVaultPath      = domain.Err("vault path is required when events are kept in database")
+	errVaultKey       = domain.Err("vault key is required when vault is kept in file")
+)